@@ -0,0 +1,258 @@
+package alerts
+
+import (
+	"fmt"
+	"go-redis2influx/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// 告警狀態
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Alert 單一事件代碼的告警，觸發和解除時各送出一次
+type Alert struct {
+	Status    string    `json:"status"`
+	Name      string    `json:"name"`
+	Code      string    `json:"code"`
+	Category  string    `json:"category"`
+	Level     string    `json:"level"`
+	Threshold string    `json:"threshold"`
+	Count     int       `json:"count"`
+	Message   string    `json:"message"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at,omitempty"`
+}
+
+// Threshold 事件門檻，例如 "5 in 1m" 表示 1 分鐘內發生 5 次
+type Threshold struct {
+	Count  int
+	Window time.Duration
+}
+
+// * 解析 "N in D" 格式的門檻，D 為 Go 的 duration (30s、1m、1h)，空字串表示不告警
+func ParseThreshold(s string) (Threshold, bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Threshold{}, false, nil
+	}
+
+	count, window, ok := strings.Cut(s, " in ")
+	if !ok {
+		return Threshold{}, false, fmt.Errorf("threshold %q must look like \"5 in 1m\"", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n <= 0 {
+		return Threshold{}, false, fmt.Errorf("threshold %q: count must be a positive integer", s)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || d <= 0 {
+		return Threshold{}, false, fmt.Errorf("threshold %q: window must be a positive duration such as 30s or 1m", s)
+	}
+	return Threshold{Count: n, Window: d}, true, nil
+}
+
+// * 解析事件的等級，只有不低於此等級的日誌才計入門檻，未設定時為 warn
+func ParseLevel(s string) (zapcore.Level, error) {
+	if s == "" {
+		return zapcore.WarnLevel, nil
+	}
+	return zapcore.ParseLevel(strings.ToLower(s))
+}
+
+// window 以最近 N 次發生的時間判斷是否超過門檻，記憶體用量固定為 N
+// 觸發：N 次都落在時間窗內；解除：時間窗內的次數降到 N/2 以下 (遲滯，避免連線時好時壞時反覆告警)
+type window struct {
+	event     models.Event
+	threshold Threshold
+	level     zapcore.Level
+	times     []time.Time
+	firing    bool
+	startsAt  time.Time
+	message   string
+}
+
+func (w *window) record(t time.Time, message string) {
+	if len(w.times) == w.threshold.Count {
+		w.times = w.times[1:]
+	}
+	w.times = append(w.times, t)
+	w.message = message
+}
+
+func (w *window) count(now time.Time) int {
+	cutoff := now.Add(-w.threshold.Window)
+	for i, t := range w.times {
+		if t.After(cutoff) {
+			return len(w.times) - i
+		}
+	}
+	return 0
+}
+
+// evaluate 回傳狀態變化時的告警，沒有變化時回傳 nil
+func (w *window) evaluate(now time.Time) *Alert {
+	count := w.count(now)
+	switch {
+	case !w.firing && count >= w.threshold.Count:
+		w.firing = true
+		w.startsAt = now
+		return w.alert(StatusFiring, count, time.Time{})
+	case w.firing && count <= w.threshold.Count/2:
+		w.firing = false
+		return w.alert(StatusResolved, count, now)
+	}
+	return nil
+}
+
+func (w *window) alert(status string, count int, endsAt time.Time) *Alert {
+	return &Alert{
+		Status:    status,
+		Name:      w.event.Name,
+		Code:      w.event.Code,
+		Category:  w.event.Category,
+		Level:     w.event.Level,
+		Threshold: w.event.Threshold,
+		Count:     count,
+		Message:   w.message,
+		StartsAt:  w.startsAt,
+		EndsAt:    endsAt,
+	}
+}
+
+var state = struct {
+	sync.Mutex
+	windows map[string]*window
+	ignore  map[string]bool
+}{windows: make(map[string]*window), ignore: make(map[string]bool)}
+
+// * 依事件目錄建立時間窗，只追蹤設定了門檻的事件，回傳被追蹤事件中最低的等級
+func track(events []models.Event) (zapcore.Level, bool) {
+	state.Lock()
+	defer state.Unlock()
+
+	minLevel, tracked := zapcore.FatalLevel, false
+	for _, event := range events {
+		threshold, enabled, err := ParseThreshold(event.Threshold)
+		level, levelErr := ParseLevel(event.Level)
+		if err != nil || levelErr != nil || !enabled {
+			continue
+		}
+		if _, ok := state.windows[event.Code]; !ok {
+			state.windows[event.Code] = &window{event: event, threshold: threshold, level: level}
+		}
+		if level < minLevel {
+			minLevel = level
+		}
+		tracked = true
+	}
+	return minLevel, tracked
+}
+
+// * 忽略指定代碼的事件，告警和通知本身的日誌不計入門檻，避免遞迴
+func Ignore(codes ...string) {
+	state.Lock()
+	for _, code := range codes {
+		state.ignore[code] = true
+	}
+	state.Unlock()
+}
+
+// 外部條件觸發中的告警，依事件代碼區分
+var conditions = struct {
+	sync.Mutex
+	firing map[string]*Alert
+}{firing: make(map[string]*Alert)}
+
+// * 設定外部條件 (例如 InfluxDB 持續無法使用、PEL 持續增長) 的告警狀態，狀態改變時才送出
+// 條件本身由呼叫端判斷，遲滯也由呼叫端決定
+func Set(event models.Event, firing bool, count int, message string) {
+	conditions.Lock()
+	defer conditions.Unlock()
+
+	now := time.Now()
+	current, active := conditions.firing[event.Code]
+	switch {
+	case firing && !active:
+		alert := Alert{
+			Status:    StatusFiring,
+			Name:      event.Name,
+			Code:      event.Code,
+			Category:  event.Category,
+			Level:     event.Level,
+			Threshold: event.Threshold,
+			Count:     count,
+			Message:   message,
+			StartsAt:  now,
+		}
+		conditions.firing[event.Code] = &alert
+		dispatch(alert)
+	case firing && active:
+		current.Count = count
+		current.Message = message
+	case !firing && active:
+		alert := *current
+		alert.Status = StatusResolved
+		alert.Count = count
+		alert.Message = message
+		alert.EndsAt = now
+		delete(conditions.firing, event.Code)
+		dispatch(alert)
+	}
+}
+
+// 記錄一次事件並立即評估
+func record(event models.Event, level zapcore.Level, t time.Time, message string) {
+	state.Lock()
+	defer state.Unlock()
+
+	w, ok := state.windows[event.Code]
+	if !ok || state.ignore[event.Code] || level < w.level {
+		return
+	}
+
+	w.record(t, message)
+	if alert := w.evaluate(t); alert != nil {
+		dispatch(*alert)
+	}
+}
+
+// 定期評估所有時間窗，沒有新事件時也能解除告警
+func evaluateAll(now time.Time) {
+	state.Lock()
+	defer state.Unlock()
+
+	for _, w := range state.windows {
+		if alert := w.evaluate(now); alert != nil {
+			dispatch(*alert)
+		}
+	}
+}
+
+// * 目前觸發中的告警
+func Firing() []Alert {
+	state.Lock()
+	defer state.Unlock()
+
+	now := time.Now()
+	var firing []Alert
+	for _, w := range state.windows {
+		if w.firing {
+			firing = append(firing, *w.alert(StatusFiring, w.count(now), time.Time{}))
+		}
+	}
+
+	conditions.Lock()
+	for _, alert := range conditions.firing {
+		firing = append(firing, *alert)
+	}
+	conditions.Unlock()
+	return firing
+}
@@ -0,0 +1,67 @@
+package alerts
+
+import (
+	"go-redis2influx/models"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// core 與其他輸出並列 (zapcore.NewTee)，計算帶有事件的日誌，不輸出任何內容
+// 與輸出端的日誌等級無關，log.level 為 error 時 warn 事件仍會計入門檻
+type core struct {
+	minLevel zapcore.Level
+	enabled  bool
+	events   []models.Event
+}
+
+// * 建立計算事件門檻的 zap core，events 為事件目錄，沒有任何事件設定門檻時不計算
+func NewCore(events []models.Event) zapcore.Core {
+	minLevel, enabled := track(events)
+	return &core{minLevel: minLevel, enabled: enabled}
+}
+
+func (c *core) Enabled(level zapcore.Level) bool {
+	return c.enabled && level >= c.minLevel
+}
+
+// With 保留 child logger 上的事件，之後每筆日誌都計入
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	events := eventsOf(fields)
+	if len(events) == 0 {
+		return c
+	}
+	clone := *c
+	clone.events = append(append([]models.Event{}, c.events...), events...)
+	return &clone
+}
+
+func (c *core) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	for _, event := range c.events {
+		record(event, entry.Level, entry.Time, entry.Message)
+	}
+	for _, event := range eventsOf(fields) {
+		record(event, entry.Level, entry.Time, entry.Message)
+	}
+	return nil
+}
+
+func (c *core) Sync() error {
+	return nil
+}
+
+func eventsOf(fields []zapcore.Field) []models.Event {
+	var events []models.Event
+	for _, field := range fields {
+		if event, ok := field.Interface.(models.Event); ok {
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,77 @@
+package alerts
+
+import (
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 告警在寫入日誌的呼叫路徑上產生，先放進佇列再由背景 goroutine 記錄和通知，避免在 zap core 內遞迴寫入日誌
+var queue = make(chan Alert, 100)
+
+var handlers struct {
+	sync.Mutex
+	funcs []func(Alert)
+}
+
+var startOnce sync.Once
+
+// * 註冊告警處理函式，觸發和解除時各呼叫一次
+func Subscribe(fn func(Alert)) {
+	handlers.Lock()
+	handlers.funcs = append(handlers.funcs, fn)
+	handlers.Unlock()
+}
+
+// * 啟動告警的背景處理：記錄告警日誌、更新指標、通知訂閱者，並每秒評估一次時間窗
+func Start() {
+	startOnce.Do(func() {
+		Ignore(global.LogEvent.Alerting.Code, global.LogEvent.Webhook.Code)
+
+		go func() {
+			for alert := range queue {
+				notify(alert)
+			}
+		}()
+
+		go func() {
+			for now := range time.Tick(time.Second) {
+				evaluateAll(now)
+			}
+		}()
+	})
+}
+
+// 佇列已滿時丟棄，不阻塞寫入日誌的呼叫端
+func dispatch(alert Alert) {
+	select {
+	case queue <- alert:
+	default:
+	}
+}
+
+func notify(alert Alert) {
+	event := zap.Any(global.LogEvent.Alerting.Name, global.LogEvent.Alerting)
+	if alert.Status == StatusFiring {
+		metrics.AlertsFiring.WithLabelValues(alert.Code).Set(1)
+		msg := fmt.Sprintf("Alert firing: %s (%s): %s", alert.Name, alert.Code, alert.Message)
+		if alert.Threshold != "" {
+			msg = fmt.Sprintf("Alert firing: %s (%s) reached %s, last message: %s", alert.Name, alert.Code, alert.Threshold, alert.Message)
+		}
+		global.Logger.Warn(msg, event)
+	} else {
+		metrics.AlertsFiring.WithLabelValues(alert.Code).Set(0)
+		global.Logger.Info(fmt.Sprintf("Alert resolved: %s (%s) after %v, %d in window", alert.Name, alert.Code, alert.EndsAt.Sub(alert.StartsAt).Round(time.Second), alert.Count), event)
+	}
+
+	handlers.Lock()
+	funcs := append([]func(Alert){}, handlers.funcs...)
+	handlers.Unlock()
+	for _, fn := range funcs {
+		fn(alert)
+	}
+}
@@ -0,0 +1,309 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// receiver 單一 webhook 接收端，擁有自己的佇列，慢速的接收端不影響其他接收端
+type receiver struct {
+	cfg      models.ReceiverModel
+	template *template.Template
+	client   *http.Client
+	queue    chan Alert
+
+	retries    int
+	retryDelay time.Duration // 第一次重試前的等待時間，之後每次加倍
+
+	mu   sync.Mutex
+	sent []time.Time
+}
+
+var receivers []*receiver
+
+// 模板可用的函式：json 將值轉成 JSON (字串會加上引號並跳脫)，time 將時間格式化為 RFC3339
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	},
+}
+
+// * 解析接收端的 payload 模板，空字串時使用 Alert 的 JSON
+func ParseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("payload").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// * 依 notify.receivers 建立 webhook 接收端並訂閱告警
+func StartWebhooks() error {
+	var errs []error
+	for _, cfg := range global.Config().Notify.Receivers {
+		r, err := newReceiver(cfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("receiver %s: %w", cfg.Name, err))
+			continue
+		}
+		receivers = append(receivers, r)
+		go r.run()
+	}
+
+	if len(receivers) > 0 {
+		Subscribe(func(alert Alert) {
+			for _, r := range receivers {
+				r.enqueue(alert)
+			}
+		})
+	}
+	return errors.Join(errs...)
+}
+
+func newReceiver(cfg models.ReceiverModel) (*receiver, error) {
+	tmpl, err := ParseTemplate(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.URL
+	}
+	retryDelay := time.Duration(cfg.RetryDelay) * time.Second
+	if retryDelay <= 0 {
+		retryDelay = 2 * time.Second
+	}
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	// 只有未設定時使用預設值，明確設定 0 時不重試
+	retries := 3
+	if cfg.Retries != nil {
+		retries = *cfg.Retries
+	}
+
+	return &receiver{
+		cfg:        cfg,
+		template:   tmpl,
+		client:     &http.Client{Timeout: timeout},
+		queue:      make(chan Alert, 100),
+		retries:    retries,
+		retryDelay: retryDelay,
+	}, nil
+}
+
+// 不符合篩選條件或超過速率限制的告警直接略過
+func (r *receiver) enqueue(alert Alert) {
+	if !r.matches(alert) {
+		return
+	}
+	now := time.Now()
+	if !r.allow(now) {
+		global.Logger.Warn(fmt.Sprintf("Webhook %s rate limit of %d per minute reached, dropped %s alert %s", r.cfg.Name, r.cfg.RateLimit, alert.Status, alert.Code),
+			zap.Any(global.LogEvent.Webhook.Name, global.LogEvent.Webhook))
+		return
+	}
+
+	select {
+	case r.queue <- alert:
+	default:
+		// 沒有送出的告警不佔用額度
+		r.release(now)
+		global.Logger.Warn(fmt.Sprintf("Webhook %s queue full, dropped %s alert %s", r.cfg.Name, alert.Status, alert.Code),
+			zap.Any(global.LogEvent.Webhook.Name, global.LogEvent.Webhook))
+	}
+}
+
+func (r *receiver) run() {
+	for alert := range r.queue {
+		if err := r.send(context.Background(), alert); err != nil {
+			global.Logger.Error(fmt.Sprintf("Failed to notify webhook %s of %s alert %s: %v", r.cfg.Name, alert.Status, alert.Code, err),
+				zap.Any(global.LogEvent.Webhook.Name, global.LogEvent.Webhook))
+			continue
+		}
+		global.Logger.Info(fmt.Sprintf("Notified webhook %s of %s alert %s", r.cfg.Name, alert.Status, alert.Code),
+			zap.Any(global.LogEvent.Webhook.Name, global.LogEvent.Webhook))
+	}
+}
+
+// events 比對事件代碼或名稱，結尾為 * 時比對前綴；statuses 為 firing 或 resolved；未設定時不篩選
+func (r *receiver) matches(alert Alert) bool {
+	if len(r.cfg.Statuses) > 0 && !contains(r.cfg.Statuses, alert.Status) {
+		return false
+	}
+	if len(r.cfg.Events) == 0 {
+		return true
+	}
+	for _, pattern := range r.cfg.Events {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(alert.Code, prefix) || strings.HasPrefix(alert.Name, prefix) {
+				return true
+			}
+			continue
+		}
+		if pattern == alert.Code || pattern == alert.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// 每分鐘最多送出 rate_limit 次，0 表示不限制
+func (r *receiver) allow(now time.Time) bool {
+	if r.cfg.RateLimit <= 0 {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := now.Add(-time.Minute)
+	for len(r.sent) > 0 && !r.sent[0].After(cutoff) {
+		r.sent = r.sent[1:]
+	}
+	if len(r.sent) >= r.cfg.RateLimit {
+		return false
+	}
+	r.sent = append(r.sent, now)
+	return true
+}
+
+// 歸還 allow 在 now 佔用的額度
+func (r *receiver) release(now time.Time) {
+	if r.cfg.RateLimit <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.sent) - 1; i >= 0; i-- {
+		if r.sent[i].Equal(now) {
+			r.sent = append(r.sent[:i], r.sent[i+1:]...)
+			return
+		}
+	}
+}
+
+func (r *receiver) render(alert Alert) ([]byte, error) {
+	if r.template == nil {
+		return json.Marshal(alert)
+	}
+	var buf bytes.Buffer
+	if err := r.template.Execute(&buf, alert); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 網路錯誤、5xx 和 429 時依指數退避重試，其他 4xx 不重試
+func (r *receiver) send(ctx context.Context, alert Alert) error {
+	body, err := r.render(alert)
+	if err != nil {
+		return fmt.Errorf("render template: %w", err)
+	}
+
+	delay := r.retryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := r.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= r.retries {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+func (r *receiver) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range r.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// * 送出測試告警到所有接收端 (或指定名稱的接收端)，忽略篩選條件和速率限制，回傳每個接收端的結果
+func SendTest(name string) (map[string]error, error) {
+	alert := Alert{
+		Status:   StatusFiring,
+		Name:     "TestNotification",
+		Code:     "TEST",
+		Category: "Alerting",
+		Level:    "info",
+		Count:    1,
+		Message:  "Test notification from go-redis2influx",
+		StartsAt: time.Now(),
+	}
+
+	results := make(map[string]error)
+	for _, cfg := range global.Config().Notify.Receivers {
+		if name != "" && cfg.Name != name {
+			continue
+		}
+		key := cfg.Name
+		if key == "" {
+			key = cfg.URL
+		}
+		r, err := newReceiver(cfg)
+		if err == nil {
+			err = r.send(context.Background(), alert)
+		}
+		results[key] = err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no webhook receiver matches %q", name)
+	}
+	return results, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
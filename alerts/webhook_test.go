@@ -0,0 +1,356 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// webhookServer 依序回傳 statuses 中的狀態碼 (用完後沿用最後一個)，並記錄收到的請求
+type webhookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	t.Helper()
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		s.bodies = append(s.bodies, body)
+		s.headers = append(s.headers, r.Header.Clone())
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status = s.statuses[0]
+			if len(s.statuses) > 1 {
+				s.statuses = s.statuses[1:]
+			}
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *webhookServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+func setupWebhookTest(t *testing.T, receivers ...models.ReceiverModel) {
+	t.Helper()
+	global.Logger = zap.NewNop()
+	global.LogEvent = &models.LogEvent{}
+	config := &models.EnvironmentModel{}
+	config.Notify.Receivers = receivers
+	global.SetConfig(config)
+}
+
+// 測試時不等待預設的重試間隔
+func newTestReceiver(t *testing.T, cfg models.ReceiverModel) *receiver {
+	t.Helper()
+	r, err := newReceiver(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.retryDelay = time.Millisecond
+	return r
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func testAlert(status, name, code string) Alert {
+	return Alert{
+		Status:   status,
+		Name:     name,
+		Code:     code,
+		Level:    "error",
+		Count:    3,
+		Message:  `InfluxDB "primary" is unavailable`,
+		StartsAt: time.Date(2024, 10, 7, 8, 22, 31, 0, time.UTC),
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	setupWebhookTest(t)
+	server := newWebhookServer(t)
+	r := newTestReceiver(t, models.ReceiverModel{
+		URL:      server.URL,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		Template: `{"text": {{json .Message}}, "code": "{{.Code}}", "status": "{{.Status}}", "since": "{{time .StartsAt}}", "ended": "{{time .EndsAt}}"}`,
+	})
+
+	if err := r.send(context.Background(), testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01")); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if server.requests() != 1 {
+		t.Fatalf("got %d requests, want 1", server.requests())
+	}
+	if got := server.headers[0].Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization header = %q, want %q", got, "Bearer token")
+	}
+	if got := server.headers[0].Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type header = %q, want application/json", got)
+	}
+
+	var payload map[string]string
+	if err := json.Unmarshal(server.bodies[0], &payload); err != nil {
+		t.Fatalf("rendered payload %s is not valid JSON: %v", server.bodies[0], err)
+	}
+	want := map[string]string{
+		"text":   `InfluxDB "primary" is unavailable`,
+		"code":   "INFLUX01",
+		"status": StatusFiring,
+		"since":  "2024-10-07T08:22:31Z",
+		"ended":  "",
+	}
+	for key, value := range want {
+		if payload[key] != value {
+			t.Errorf("payload[%q] = %q, want %q", key, payload[key], value)
+		}
+	}
+}
+
+func TestWebhookDefaultPayload(t *testing.T) {
+	setupWebhookTest(t)
+	server := newWebhookServer(t)
+	r := newTestReceiver(t, models.ReceiverModel{URL: server.URL})
+
+	alert := testAlert(StatusResolved, "OutputInfluxDB", "INFLUX01")
+	if err := r.send(context.Background(), alert); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	var got Alert
+	if err := json.Unmarshal(server.bodies[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != alert.Status || got.Code != alert.Code || got.Message != alert.Message || !got.StartsAt.Equal(alert.StartsAt) {
+		t.Errorf("payload = %+v, want %+v", got, alert)
+	}
+}
+
+func TestWebhookTemplateError(t *testing.T) {
+	setupWebhookTest(t)
+	server := newWebhookServer(t)
+	r := newTestReceiver(t, models.ReceiverModel{URL: server.URL, Template: `{{.Missing}}`})
+
+	if err := r.send(context.Background(), testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01")); err == nil {
+		t.Fatal("expected a render error for an unknown field")
+	}
+	if server.requests() != 0 {
+		t.Errorf("got %d requests, want none when the template fails", server.requests())
+	}
+}
+
+func TestWebhookFilters(t *testing.T) {
+	setupWebhookTest(t)
+	tests := []struct {
+		name     string
+		events   []string
+		statuses []string
+		alert    Alert
+		want     bool
+	}{
+		{"no filter", nil, nil, testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"), true},
+		{"exact code", []string{"INFLUX01"}, nil, testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"), true},
+		{"exact name", []string{"OutputInfluxDB"}, nil, testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"), true},
+		{"code prefix", []string{"REDIS*"}, nil, testAlert(StatusFiring, "ConsumerStopped", "REDIS11"), true},
+		{"name prefix", []string{"Output*"}, nil, testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"), true},
+		{"other event", []string{"REDIS*", "DATA02"}, nil, testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"), false},
+		{"partial code without wildcard", []string{"INFLUX"}, nil, testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"), false},
+		{"status matches", nil, []string{StatusFiring}, testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"), true},
+		{"status excluded", nil, []string{StatusFiring}, testAlert(StatusResolved, "OutputInfluxDB", "INFLUX01"), false},
+		{"event matches, status excluded", []string{"INFLUX01"}, []string{StatusResolved}, testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestReceiver(t, models.ReceiverModel{URL: "http://127.0.0.1:1", Events: tt.events, Statuses: tt.statuses})
+			r.enqueue(tt.alert)
+			if got := len(r.queue) == 1; got != tt.want {
+				t.Errorf("queued = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	setupWebhookTest(t)
+	tests := []struct {
+		name     string
+		retries  *int
+		statuses []int
+		requests int
+		wantErr  bool
+	}{
+		{"success", nil, []int{http.StatusNoContent}, 1, false},
+		{"5xx retried until success", nil, []int{http.StatusBadGateway, http.StatusInternalServerError, http.StatusOK}, 3, false},
+		{"429 retried until success", nil, []int{http.StatusTooManyRequests, http.StatusOK}, 2, false},
+		{"5xx gives up after default retries", nil, []int{http.StatusServiceUnavailable}, 4, true},
+		{"429 gives up after configured retries", intPtr(1), []int{http.StatusTooManyRequests}, 2, true},
+		{"retries 0 disables retry", intPtr(0), []int{http.StatusInternalServerError}, 1, true},
+		{"400 not retried", nil, []int{http.StatusBadRequest, http.StatusOK}, 1, true},
+		{"401 not retried", nil, []int{http.StatusUnauthorized, http.StatusOK}, 1, true},
+		{"404 not retried", nil, []int{http.StatusNotFound, http.StatusOK}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newWebhookServer(t, tt.statuses...)
+			r := newTestReceiver(t, models.ReceiverModel{URL: server.URL, Retries: tt.retries})
+
+			err := r.send(context.Background(), testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("send error = %v, want error %v", err, tt.wantErr)
+			}
+			if server.requests() != tt.requests {
+				t.Errorf("got %d requests, want %d", server.requests(), tt.requests)
+			}
+		})
+	}
+}
+
+func TestWebhookRetryNetworkError(t *testing.T) {
+	setupWebhookTest(t)
+	server := newWebhookServer(t)
+	url := server.URL
+	server.Close()
+
+	r := newTestReceiver(t, models.ReceiverModel{URL: url, Retries: intPtr(2)})
+	start := time.Now()
+	if err := r.send(context.Background(), testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01")); err == nil {
+		t.Fatal("expected an error when the receiver is unreachable")
+	}
+	// 重試間隔 1ms、2ms，確認有退避但不會等待預設的秒數
+	if elapsed := time.Since(start); elapsed < 3*time.Millisecond || elapsed > time.Second {
+		t.Errorf("send took %v, want the two backoff delays", elapsed)
+	}
+}
+
+func TestWebhookRateLimit(t *testing.T) {
+	setupWebhookTest(t)
+	r := newTestReceiver(t, models.ReceiverModel{URL: "http://127.0.0.1:1", RateLimit: 2})
+
+	for i := 0; i < 3; i++ {
+		r.enqueue(testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"))
+	}
+	if len(r.queue) != 2 {
+		t.Fatalf("queued %d alerts, want 2 with rate_limit 2", len(r.queue))
+	}
+
+	// 被篩選掉的告警不佔用額度
+	r.cfg.Events = []string{"REDIS*"}
+	r.mu.Lock()
+	r.sent = nil
+	r.mu.Unlock()
+	r.enqueue(testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"))
+	if len(r.sent) != 0 {
+		t.Errorf("filtered alert used the rate limit, sent = %v", r.sent)
+	}
+
+	// 額度以一分鐘的滑動視窗計算
+	now := time.Now()
+	if !r.allow(now) || !r.allow(now.Add(time.Second)) {
+		t.Fatal("first two alerts in the window should be allowed")
+	}
+	if r.allow(now.Add(30 * time.Second)) {
+		t.Error("third alert within a minute should be dropped")
+	}
+	if !r.allow(now.Add(time.Minute + time.Second)) {
+		t.Error("alert after the first one left the window should be allowed")
+	}
+}
+
+func TestWebhookRateLimitQueueFull(t *testing.T) {
+	setupWebhookTest(t)
+	r := newTestReceiver(t, models.ReceiverModel{URL: "http://127.0.0.1:1", RateLimit: 2})
+	r.queue = make(chan Alert, 1)
+
+	// 佇列已滿而丟棄的告警不佔用額度
+	r.enqueue(testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01"))
+	r.enqueue(testAlert(StatusResolved, "OutputInfluxDB", "INFLUX01"))
+	if len(r.sent) != 1 {
+		t.Fatalf("sent = %v, want only the queued alert counted", r.sent)
+	}
+
+	<-r.queue
+	r.enqueue(testAlert(StatusResolved, "OutputInfluxDB", "INFLUX01"))
+	if len(r.queue) != 1 {
+		t.Error("alert after the queue drained should be within the rate limit")
+	}
+}
+
+func TestWebhookRateLimitPerReceiver(t *testing.T) {
+	setupWebhookTest(t)
+	limited := newTestReceiver(t, models.ReceiverModel{URL: "http://127.0.0.1:1", RateLimit: 1})
+	unlimited := newTestReceiver(t, models.ReceiverModel{URL: "http://127.0.0.1:2"})
+
+	for i := 0; i < 3; i++ {
+		alert := testAlert(StatusFiring, "OutputInfluxDB", "INFLUX01")
+		limited.enqueue(alert)
+		unlimited.enqueue(alert)
+	}
+	if len(limited.queue) != 1 || len(unlimited.queue) != 3 {
+		t.Errorf("queued %d and %d alerts, want 1 and 3", len(limited.queue), len(unlimited.queue))
+	}
+}
+
+func TestSendTest(t *testing.T) {
+	ok := newWebhookServer(t)
+	missing := newWebhookServer(t, http.StatusNotFound)
+	setupWebhookTest(t,
+		// 測試告警忽略篩選條件和速率限制
+		models.ReceiverModel{Name: "ok", URL: ok.URL, Events: []string{"REDIS*"}, Statuses: []string{StatusResolved}, RateLimit: 1},
+		models.ReceiverModel{Name: "missing", URL: missing.URL, Retries: intPtr(0)},
+	)
+
+	results, err := SendTest("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results["ok"] != nil || results["missing"] == nil {
+		t.Errorf("results = %v, want ok to succeed and missing to fail", results)
+	}
+
+	var alert Alert
+	if err := json.Unmarshal(ok.bodies[0], &alert); err != nil {
+		t.Fatal(err)
+	}
+	if alert.Code != "TEST" || alert.Status != StatusFiring {
+		t.Errorf("test alert = %+v, want a firing TEST alert", alert)
+	}
+
+	results, err = SendTest("ok")
+	if err != nil || len(results) != 1 || results["ok"] != nil {
+		t.Errorf("SendTest(ok) = %v, %v; want only ok to succeed", results, err)
+	}
+	if ok.requests() != 2 || missing.requests() != 1 {
+		t.Errorf("got %d and %d requests, want 2 and 1", ok.requests(), missing.requests())
+	}
+
+	if _, err := SendTest("unknown"); err == nil {
+		t.Error("expected an error for an unknown receiver name")
+	}
+}
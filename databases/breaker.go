@@ -0,0 +1,257 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker 由實際寫入結果驅動，只有在開啟狀態時才探測 /health
+// closed: 正常寫入，連續失敗達門檻後開啟
+// open: 拒絕寫入，依指數退避 (含 jitter，有上限) 探測健康狀態
+// half-open: 探測成功後允許一次試寫，成功則關閉，失敗則重新開啟
+type circuitBreaker struct {
+	mu        sync.Mutex
+	name      string
+	state     breakerState
+	failures  int
+	attempt   int
+	trial     bool
+	probing   bool
+	nextProbe time.Time
+	lastErr   error
+	since     time.Time
+
+	threshold int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	probe     func(ctx context.Context) error
+}
+
+func newCircuitBreaker(name string, baseDelay time.Duration, probe func(ctx context.Context) error) *circuitBreaker {
+	metrics.OutputState.WithLabelValues(name).Set(float64(stateClosed))
+
+	b := &circuitBreaker{name: name, probe: probe, since: time.Now()}
+	b.configure(baseDelay)
+	return b
+}
+
+// configure 依目前的 circuit_breaker 設定更新門檻和退避時間，重新載入設定時也會呼叫
+func (b *circuitBreaker) configure(baseDelay time.Duration) {
+	cfg := global.Config().CircuitBreaker
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.threshold = cfg.FailureThreshold
+	b.baseDelay = baseDelay
+	b.maxDelay = time.Duration(cfg.MaxDelay) * time.Second
+	if b.threshold <= 0 {
+		b.threshold = 3
+	}
+	if b.baseDelay <= 0 {
+		b.baseDelay = time.Second
+	}
+	if b.maxDelay < b.baseDelay {
+		b.maxDelay = 60 * b.baseDelay
+	}
+}
+
+// Ready 回傳目前是否可以寫入，開啟狀態且到達探測時間時會探測一次健康狀態
+func (b *circuitBreaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probeIfDue()
+	return b.state != stateOpen
+}
+
+// Allow 在寫入前呼叫，half-open 狀態下同時只允許一次試寫
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probeIfDue()
+	switch b.state {
+	case stateClosed:
+		return true
+	case stateHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return false
+	}
+}
+
+// Success 記錄一次成功的寫入
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trial = false
+	if b.state != stateClosed {
+		b.attempt = 0
+		b.transition(stateClosed, nil)
+	}
+}
+
+// Failure 記錄一次失敗的寫入
+func (b *circuitBreaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	b.lastErr = err
+	switch b.state {
+	case stateClosed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open(err)
+		}
+	case stateHalfOpen:
+		b.attempt++
+		b.open(err)
+	}
+}
+
+// Throttle 輸出端要求限流 (429/503) 時立即開啟，至少等待 retryAfter 後才探測
+func (b *circuitBreaker) Throttle(err error, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	b.lastErr = err
+	b.schedule()
+	if until := time.Now().Add(retryAfter); until.After(b.nextProbe) {
+		b.nextProbe = until
+	}
+	b.transition(stateOpen, err)
+}
+
+// Wait 回傳距離下一次探測的時間
+func (b *circuitBreaker) Wait() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != stateOpen {
+		return 0
+	}
+	if wait := time.Until(b.nextProbe); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// State 回傳目前狀態、進入此狀態的時間和最後一次寫入錯誤
+func (b *circuitBreaker) State() (breakerState, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state, b.since, b.lastErr
+}
+
+// 呼叫端需持有 b.mu，探測期間釋放鎖，State、Allow、Wait 不會被探測阻塞，探測中的斷路器仍視為開啟
+func (b *circuitBreaker) probeIfDue() {
+	if b.state != stateOpen || b.probing || time.Now().Before(b.nextProbe) {
+		return
+	}
+
+	if b.probe != nil {
+		b.probing = true
+		b.mu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout())
+		err := b.probe(ctx)
+		cancel()
+		b.mu.Lock()
+		b.probing = false
+
+		// 探測期間可能已由寫入結果改變狀態
+		if b.state != stateOpen {
+			return
+		}
+		if err != nil {
+			b.lastErr = err
+			b.attempt++
+			b.schedule()
+			global.Logger.Debug(fmt.Sprintf("Circuit breaker %s health probe failed, next probe in %v: %v", b.name, time.Until(b.nextProbe).Round(time.Millisecond), err),
+				zap.Any(global.LogEvent.CircuitBreaker.Name, global.LogEvent.CircuitBreaker))
+			return
+		}
+	}
+	b.transition(stateHalfOpen, nil)
+}
+
+// 健康探測的逾時，使用 health.timeout，未設定時為 2 秒
+func probeTimeout() time.Duration {
+	if timeout := time.Duration(global.Config().Health.Timeout) * time.Second; timeout > 0 {
+		return timeout
+	}
+	return 2 * time.Second
+}
+
+func (b *circuitBreaker) open(err error) {
+	b.schedule()
+	b.transition(stateOpen, err)
+}
+
+// 指數退避加上 jitter，延遲介於 [d/2, d) 之間，且不超過上限
+func (b *circuitBreaker) schedule() {
+	delay := b.maxDelay
+	if b.attempt < 30 {
+		if d := b.baseDelay << uint(b.attempt); d > 0 && d < b.maxDelay {
+			delay = d
+		}
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	b.nextProbe = time.Now().Add(delay)
+}
+
+func (b *circuitBreaker) transition(to breakerState, err error) {
+	from := b.state
+	b.state = to
+	if from == to {
+		return
+	}
+	b.since = time.Now()
+	metrics.OutputState.WithLabelValues(b.name).Set(float64(to))
+
+	msg := fmt.Sprintf("Circuit breaker %s: %s -> %s", b.name, from, to)
+	if to == stateOpen {
+		msg = fmt.Sprintf("%s, next probe in %v: %v", msg, time.Until(b.nextProbe).Round(time.Millisecond), err)
+		global.Logger.Warn(msg, zap.Any(global.LogEvent.CircuitBreaker.Name, global.LogEvent.CircuitBreaker))
+		return
+	}
+	global.Logger.Info(msg, zap.Any(global.LogEvent.CircuitBreaker.Name, global.LogEvent.CircuitBreaker))
+}
@@ -0,0 +1,51 @@
+package databases
+
+import (
+	"go-redis2influx/models"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Chunk 單次寫入請求的內容，同時受行數和未壓縮位元組數限制
+type Chunk struct {
+	Lines []string
+	IDs   []string // 內容所屬的消息 ID，依序且不重複
+	Size  int      // 未壓縮的位元組數，包含換行
+
+	// 帶有批次關聯 ID 的 logger，best-effort 輸出端之後重試時也使用
+	Logger *zap.Logger
+}
+
+// * 依行數和位元組數上限切分批次，單一消息可能跨越多個 chunk
+// 超過位元組上限的單行會獨立成一個 chunk
+func splitChunks(messages []models.Message, maxLines, maxBytes int) []*Chunk {
+	var chunks []*Chunk
+	current := &Chunk{}
+
+	for _, message := range messages {
+		for _, line := range strings.Split(message.Data, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+
+			size := len(line) + 1
+			if len(current.Lines) > 0 && (len(current.Lines) >= maxLines || current.Size+size > maxBytes) {
+				chunks = append(chunks, current)
+				current = &Chunk{}
+			}
+
+			current.Lines = append(current.Lines, line)
+			current.Size += size
+			if n := len(current.IDs); n == 0 || current.IDs[n-1] != message.ID {
+				current.IDs = append(current.IDs, message.ID)
+			}
+		}
+	}
+
+	if len(current.Lines) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
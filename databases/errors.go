@@ -0,0 +1,165 @@
+package databases
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	ihttp "github.com/influxdata/influxdb-client-go/v2/api/http"
+)
+
+// ErrorClass 錯誤分類，消費迴圈依分類決定退避、隔離資料或停止並告警
+type ErrorClass int
+
+const (
+	ClassTransient ErrorClass = iota // 網路錯誤、逾時、5xx、斷路器開啟：退避後重試
+	ClassRateLimit                   // 429、帶 Retry-After 的 503：等待 Retry-After 後重試
+	ClassBadData                     // 400、422：資料本身無法寫入，重試也不會成功，隔離到 dead-letter stream
+	ClassAuth                        // 401、403：token 失效或權限不足，停止消費並告警
+	ClassConfig                      // 404 (bucket 或 org 不存在)、413 及其他 4xx、設定錯誤：停止消費並告警
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassRateLimit:
+		return "rate_limit"
+	case ClassBadData:
+		return "bad_data"
+	case ClassAuth:
+		return "auth"
+	case ClassConfig:
+		return "config"
+	default:
+		return "transient"
+	}
+}
+
+// 同一 chunk 在多個輸出端失敗時取最嚴重的分類，隔離資料必須所有輸出端都是 bad_data
+var classSeverity = map[ErrorClass]int{
+	ClassBadData:   0,
+	ClassTransient: 1,
+	ClassRateLimit: 2,
+	ClassAuth:      3,
+	ClassConfig:    4,
+}
+
+// * 回傳兩個分類中較嚴重的一個
+func WorseClass(a, b ErrorClass) ErrorClass {
+	if classSeverity[b] > classSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// ClassifiedError 帶有分類的錯誤，Source 為輸出端名稱或 redis
+type ClassifiedError struct {
+	Class      ErrorClass
+	Source     string
+	Status     int           // HTTP 狀態碼，非 HTTP 錯誤時為 0
+	RetryAfter time.Duration // 限流時伺服器要求的等待時間
+	IDs        []string      // 寫入失敗的消息 ID
+	Err        error
+}
+
+// 包裝其他分類過的錯誤時 (例如 chunk 在多個輸出端失敗) 不重複來源和分類
+func (e *ClassifiedError) Error() string {
+	var inner *ClassifiedError
+	if errors.As(e.Err, &inner) {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s (%s): %v", e.Source, e.Class, e.Err)
+}
+
+func (e *ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// * 將錯誤分類，已分類的錯誤直接回傳
+// InfluxDB 的 HTTP 錯誤依狀態碼分類，權限不足的檔案錯誤為設定錯誤，其他 (網路、逾時、斷路器開啟) 為暫時性錯誤
+func Classify(source string, err error) *ClassifiedError {
+	var classified *ClassifiedError
+	if errors.As(err, &classified) {
+		return classified
+	}
+
+	classified = &ClassifiedError{Class: ClassTransient, Source: source, Err: err}
+	var httpErr *ihttp.Error
+	switch {
+	case errors.As(err, &httpErr) && httpErr.StatusCode != 0:
+		classified.Status = httpErr.StatusCode
+		classified.RetryAfter = time.Duration(httpErr.RetryAfter) * time.Second
+		classified.Class = ClassifyStatus(classified.Status, classified.RetryAfter)
+	case errors.Is(err, fs.ErrPermission):
+		classified.Class = ClassConfig
+	}
+	return classified
+}
+
+// * 依 HTTP 狀態碼分類，503 只有帶 Retry-After 時視為限流
+func ClassifyStatus(status int, retryAfter time.Duration) ErrorClass {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ClassRateLimit
+	case status == http.StatusServiceUnavailable && retryAfter > 0:
+		return ClassRateLimit
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		return ClassBadData
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ClassAuth
+	case status >= 400 && status < 500:
+		return ClassConfig
+	default:
+		return ClassTransient
+	}
+}
+
+// * 解析 Retry-After，可為秒數或 HTTP 日期，無法解析時回傳 0
+func ParseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// * 取出 WriteLineProtocol 回傳的錯誤中所有分類過的錯誤 (每個失敗的 chunk 一個)
+func ClassifiedErrors(err error) []*ClassifiedError {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []*ClassifiedError
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, ClassifiedErrors(e)...)
+		}
+		return errs
+	}
+	var classified *ClassifiedError
+	if errors.As(err, &classified) {
+		return []*ClassifiedError{classified}
+	}
+	return []*ClassifiedError{{Class: ClassTransient, Err: err}}
+}
+
+// * 回傳最嚴重的錯誤，沒有錯誤時回傳 nil
+func WorstError(err error) *ClassifiedError {
+	var worst *ClassifiedError
+	for _, e := range ClassifiedErrors(err) {
+		if worst == nil || WorseClass(worst.Class, e.Class) != worst.Class {
+			worst = e
+		}
+	}
+	return worst
+}
@@ -0,0 +1,228 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 事件日誌的預設值
+const (
+	defaultEventMeasurement   = "redis2influx_events"
+	defaultEventBufferSize    = 1000
+	defaultEventFlushInterval = 5
+)
+
+// 等待寫入的事件資料點，超過 events.buffer_size 時丟棄最舊的
+var eventLog = struct {
+	sync.Mutex
+	points  []*write.Point
+	dropped int
+}{}
+
+// eventLogCore 與其他輸出並列 (zapcore.NewTee)，將帶有事件的日誌轉成資料點放進緩衝區，由 StartEventLog 非同步寫入
+// 寫入事件日誌本身的日誌使用 EventLog 事件且不會轉成資料點，InfluxDB 無法寫入時不會遞迴
+type eventLogCore struct {
+	zapcore.LevelEnabler
+	events []models.Event
+	stream string
+}
+
+// * 建立將 warn/error 事件寫入 events.bucket 的 zap core，未設定 bucket 時不記錄
+func NewEventLogCore() zapcore.Core {
+	cfg := global.Config().Events
+	if cfg.Bucket == "" {
+		return zapcore.NewNopCore()
+	}
+
+	level := zapcore.WarnLevel
+	if cfg.Level != "" {
+		level, _ = zapcore.ParseLevel(cfg.Level)
+	}
+	return &eventLogCore{LevelEnabler: level}
+}
+
+// With 保留 child logger 上的事件和 stream，之後每筆日誌都沿用
+func (c *eventLogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	events, stream := eventFields(fields)
+	if len(events) > 0 {
+		clone.events = append(append([]models.Event{}, c.events...), events...)
+	}
+	if stream != "" {
+		clone.stream = stream
+	}
+	return &clone
+}
+
+func (c *eventLogCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *eventLogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	events, stream := eventFields(fields)
+	events = append(events, c.events...)
+	if len(events) == 0 || events[0].Code == global.LogEvent.EventLog.Code {
+		return nil
+	}
+	if stream == "" {
+		stream = c.stream
+	}
+	if stream == "" {
+		stream = global.Config().Redis.StreamKey
+	}
+
+	event := events[0]
+	point := write.NewPoint(eventMeasurement(),
+		map[string]string{
+			"code":     event.Code,
+			"category": event.Category,
+			"event":    event.Name,
+			"level":    entry.Level.String(),
+			"stream":   stream,
+			"instance": eventInstance(),
+		},
+		map[string]interface{}{"message": entry.Message},
+		entry.Time)
+	bufferEvent(point)
+	return nil
+}
+
+func (c *eventLogCore) Sync() error {
+	return nil
+}
+
+// 從欄位中取出事件和 stream (zap.String("stream", ...))
+func eventFields(fields []zapcore.Field) ([]models.Event, string) {
+	var events []models.Event
+	var stream string
+	for _, field := range fields {
+		if event, ok := field.Interface.(models.Event); ok {
+			events = append(events, event)
+		}
+		if field.Key == "stream" && field.Type == zapcore.StringType {
+			stream = field.String
+		}
+	}
+	return events, stream
+}
+
+func bufferEvent(point *write.Point) {
+	eventLog.Lock()
+	eventLog.points = append(eventLog.points, point)
+	trimEvents()
+	eventLog.Unlock()
+}
+
+// 超過 buffer_size 時丟棄最舊的事件，呼叫端需持有 eventLog 的鎖
+func trimEvents() {
+	size := global.Config().Events.BufferSize
+	if size <= 0 {
+		size = defaultEventBufferSize
+	}
+	if excess := len(eventLog.points) - size; excess > 0 {
+		eventLog.points = eventLog.points[excess:]
+		eventLog.dropped += excess
+	}
+}
+
+// * 定期將緩衝區的事件寫入 events.bucket，寫入失敗時保留到下一次 (受 buffer_size 限制)
+func StartEventLog() {
+	cfg := global.Config().Events
+	if cfg.Bucket == "" {
+		return
+	}
+	interval := cfg.FlushInterval
+	if interval <= 0 {
+		interval = defaultEventFlushInterval
+	}
+
+	go func() {
+		for range time.Tick(time.Duration(interval) * time.Second) {
+			flushEvents(cfg.Bucket)
+		}
+	}()
+}
+
+func flushEvents(bucket string) {
+	eventLog.Lock()
+	points, dropped := eventLog.points, eventLog.dropped
+	eventLog.points, eventLog.dropped = nil, 0
+	eventLog.Unlock()
+
+	if dropped > 0 {
+		global.Logger.Warn(fmt.Sprintf("Event log buffer full, dropped %d oldest events", dropped),
+			zap.Any(global.LogEvent.EventLog.Name, global.LogEvent.EventLog))
+	}
+	if len(points) == 0 {
+		return
+	}
+
+	if err := writeEvents(bucket, points); err != nil {
+		// 放回緩衝區最前面，之後的事件仍依 buffer_size 限制
+		eventLog.Lock()
+		eventLog.points = append(points, eventLog.points...)
+		trimEvents()
+		eventLog.Unlock()
+
+		if errors.Is(err, ErrCircuitOpen) {
+			return
+		}
+		global.Logger.Warn(fmt.Sprintf("Failed to write %d events to bucket %s, retrying: %v", len(points), bucket, err),
+			zap.Any(global.LogEvent.EventLog.Name, global.LogEvent.EventLog))
+		return
+	}
+	global.Logger.Debug(fmt.Sprintf("Written %d events to bucket %s", len(points), bucket),
+		zap.Any(global.LogEvent.EventLog.Name, global.LogEvent.EventLog))
+}
+
+var eventClient struct {
+	sync.Once
+	client influxdb2.Client
+}
+
+// 與自我遙測使用相同的 influxdb 區塊連線，但精度為毫秒，同一秒內的多個事件不會互相覆蓋
+func writeEvents(bucket string, points []*write.Point) error {
+	if requiredOutputOpen() {
+		return ErrCircuitOpen
+	}
+
+	db := global.Config().Influxdb
+	eventClient.Do(func() {
+		eventClient.client = newInfluxDBClient(db.URL, db.Token, time.Millisecond)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return eventClient.client.WriteAPIBlocking(db.Org, bucket).WritePoint(ctx, points...)
+}
+
+func eventMeasurement() string {
+	if m := strings.TrimSpace(global.Config().Events.Measurement); m != "" {
+		return m
+	}
+	return defaultEventMeasurement
+}
+
+// 與自我遙測相同，未設定 telemetry.instance 時使用 hostname
+func eventInstance() string {
+	if instance := global.Config().Telemetry.Instance; instance != "" {
+		return instance
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
@@ -0,0 +1,340 @@
+package databases
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"go-redis2influx/models"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const manifestFileName = "manifest.jsonl"
+
+// fileOutput 將驗證過的 line protocol 寫入輪替檔案，供隔離網路的站點以磁碟攜出
+// 每次寫入都會 fsync 後才回傳，檔案關閉時在 manifest 記錄消息 ID 範圍和行數
+type fileOutput struct {
+	mu      sync.Mutex
+	name    string
+	dir     string
+	rotate  string
+	maxSize int64
+	gzip    bool
+
+	file    *os.File
+	gz      *gzip.Writer
+	writer  io.Writer
+	path    string
+	opened  time.Time
+	size    int64
+	lines   int
+	firstID string
+	lastID  string
+
+	unrecorded []manifestEntry // 已關閉但 manifest 尚未寫入成功的檔案，下次關閉或 flush 時重試
+	stop       chan struct{}
+}
+
+// manifestEntry manifest.jsonl 中的一行，對應一個已關閉的檔案
+type manifestEntry struct {
+	File    string `json:"file"`
+	FirstID string `json:"first_id"`
+	LastID  string `json:"last_id"`
+	Lines   int    `json:"lines"`
+	Bytes   int64  `json:"bytes"`
+	Opened  string `json:"opened"`
+	Closed  string `json:"closed"`
+}
+
+func newFileOutput(cfg models.OutputModel) (*fileOutput, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("file output requires path")
+	}
+	if err := os.MkdirAll(cfg.Path, 0o755); err != nil {
+		return nil, err
+	}
+
+	o := &fileOutput{
+		name:    cfg.Name,
+		dir:     cfg.Path,
+		rotate:  cfg.Rotate,
+		maxSize: int64(cfg.MaxSize) * 1024 * 1024,
+		gzip:    cfg.Gzip,
+		stop:    make(chan struct{}),
+	}
+	if o.rotate == "" {
+		o.rotate = "hourly"
+	}
+	if o.rotate != "hourly" && o.rotate != "size" {
+		return nil, fmt.Errorf("unknown file rotate mode %q", o.rotate)
+	}
+	if o.rotate == "size" && o.maxSize <= 0 {
+		o.maxSize = 100 * 1024 * 1024
+	}
+
+	// 沒有資料寫入時也要按時關閉每小時的檔案，並重試寫入失敗的 manifest
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-o.stop:
+				return
+			case <-ticker.C:
+			}
+
+			o.mu.Lock()
+			if (o.file != nil && o.shouldRotate(time.Now())) || len(o.unrecorded) > 0 {
+				if err := o.closeFile(); err != nil {
+					global.Logger.Error(fmt.Sprintf("Output %s failed to close %s: %v", o.name, o.path, err),
+						zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+				}
+			}
+			o.mu.Unlock()
+		}
+	}()
+
+	return o, nil
+}
+
+func (o *fileOutput) Name() string {
+	return o.name
+}
+
+func (o *fileOutput) Write(ctx context.Context, chunk *Chunk) error {
+	var buf strings.Builder
+	valid, rejected := 0, 0
+	now := time.Now()
+	for _, line := range chunk.Lines {
+		if _, err := parseLine(line, now); err != nil {
+			rejected++
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+		valid++
+	}
+	if rejected > 0 {
+		metrics.LinesRejected.WithLabelValues("invalid_line_protocol").Add(float64(rejected))
+		chunk.Logger.Warn(fmt.Sprintf("Output %s skipped %d invalid line protocol lines", o.name, rejected),
+			zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+	}
+	if valid == 0 {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.file != nil && o.shouldRotate(now) {
+		if err := o.closeFile(); err != nil {
+			return err
+		}
+	}
+	if o.file == nil {
+		if err := o.openFile(now); err != nil {
+			return err
+		}
+	}
+
+	n, err := io.WriteString(o.writer, buf.String())
+	if err != nil {
+		return err
+	}
+	if o.gz != nil {
+		if err := o.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	// fsync 完成後才回傳，消息才會被確認
+	if err := o.file.Sync(); err != nil {
+		return err
+	}
+
+	o.size += int64(n)
+	o.lines += valid
+	for _, id := range chunk.IDs {
+		if o.firstID == "" || compareStreamID(id, o.firstID) < 0 {
+			o.firstID = id
+		}
+		if o.lastID == "" || compareStreamID(id, o.lastID) > 0 {
+			o.lastID = id
+		}
+	}
+	return nil
+}
+
+// Flush 關閉目前的檔案並寫入 manifest，讓已寫入的資料可以立即攜出
+func (o *fileOutput) Flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.file == nil && len(o.unrecorded) == 0 {
+		return nil
+	}
+	return o.closeFile()
+}
+
+// Close 停止定期關閉檔案，關閉目前的檔案並寫入 manifest，重新載入輸出端時呼叫
+func (o *fileOutput) Close() error {
+	close(o.stop)
+	return o.Flush()
+}
+
+func (o *fileOutput) shouldRotate(now time.Time) bool {
+	if o.rotate == "size" {
+		return o.size >= o.maxSize
+	}
+	return !now.Truncate(time.Hour).Equal(o.opened.Truncate(time.Hour))
+}
+
+func (o *fileOutput) openFile(now time.Time) error {
+	ext := ".lp"
+	if o.gzip {
+		ext += ".gz"
+	}
+
+	var file *os.File
+	var path string
+	for seq := 0; ; seq++ {
+		path = filepath.Join(o.dir, fmt.Sprintf("%s-%s-%03d%s", o.name, now.Format("20060102T150405"), seq, ext))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			file = f
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+	}
+
+	o.file, o.path, o.opened = file, path, now
+	o.size, o.lines, o.firstID, o.lastID = 0, 0, "", ""
+	o.writer = file
+	o.gz = nil
+	if o.gzip {
+		o.gz = gzip.NewWriter(file)
+		o.writer = o.gz
+	}
+
+	global.Logger.Info(fmt.Sprintf("Output %s opened %s", o.name, path),
+		zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+	return syncDir(o.dir)
+}
+
+// 關閉目前檔案並在 manifest 追加一筆紀錄
+// manifest 寫入失敗時保留紀錄，下次關閉或 flush 時連同新的紀錄一起重試
+func (o *fileOutput) closeFile() error {
+	if o.file != nil {
+		if o.gz != nil {
+			if err := o.gz.Close(); err != nil {
+				return err
+			}
+		}
+		if err := o.file.Sync(); err != nil {
+			return err
+		}
+		if err := o.file.Close(); err != nil {
+			return err
+		}
+
+		o.unrecorded = append(o.unrecorded, manifestEntry{
+			File:    filepath.Base(o.path),
+			FirstID: o.firstID,
+			LastID:  o.lastID,
+			Lines:   o.lines,
+			Bytes:   o.size,
+			Opened:  o.opened.Format(time.RFC3339),
+			Closed:  time.Now().Format(time.RFC3339),
+		})
+		o.file, o.gz, o.writer = nil, nil, nil
+	}
+
+	if err := o.writeManifest(); err != nil {
+		return fmt.Errorf("append %d entries to %s: %w", len(o.unrecorded), manifestFileName, err)
+	}
+	return nil
+}
+
+// 將尚未記錄的檔案追加到 manifest，fsync 成功後才清除
+func (o *fileOutput) writeManifest() error {
+	if len(o.unrecorded) == 0 {
+		return nil
+	}
+
+	var data []byte
+	for _, entry := range o.unrecorded {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	manifest, err := os.OpenFile(filepath.Join(o.dir, manifestFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+	if _, err := manifest.Write(data); err != nil {
+		return err
+	}
+	if err := manifest.Sync(); err != nil {
+		return err
+	}
+
+	for _, entry := range o.unrecorded {
+		global.Logger.Info(fmt.Sprintf("Output %s closed %s with %d lines (%s - %s)", o.name, entry.File, entry.Lines, entry.FirstID, entry.LastID),
+			zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+	}
+	o.unrecorded = nil
+	return nil
+}
+
+// 新建檔案後 fsync 目錄，確保檔案項目本身也落盤
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// * 比較兩個 Stream ID (毫秒時間戳-序號)
+func compareStreamID(a, b string) int {
+	aMs, aSeq := splitStreamID(a)
+	bMs, bSeq := splitStreamID(b)
+	switch {
+	case aMs != bMs:
+		if aMs < bMs {
+			return -1
+		}
+		return 1
+	case aSeq != bSeq:
+		if aSeq < bSeq {
+			return -1
+		}
+		return 1
+	default:
+		return 0
+	}
+}
+
+func splitStreamID(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	msValue, _ := strconv.ParseUint(ms, 10, 64)
+	seqValue, _ := strconv.ParseUint(seq, 10, 64)
+	return msValue, seqValue
+}
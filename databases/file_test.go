@@ -0,0 +1,106 @@
+package databases
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readManifest(t *testing.T, dir string) []manifestEntry {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry manifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestFileOutputManifestRetry(t *testing.T) {
+	setupPrometheusTest(t)
+	dir := t.TempDir()
+	output, err := newFileOutput(models.OutputModel{Name: "archive", Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+
+	chunk := &Chunk{Lines: []string{"cpu usage=1 1700000000"}, IDs: []string{"1-0", "2-0"}, Logger: global.Logger}
+	if err := output.Write(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	// manifest.jsonl 是目錄時無法開啟，紀錄要保留到下次 flush
+	manifest := filepath.Join(dir, manifestFileName)
+	if err := os.Mkdir(manifest, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := output.Flush(); err == nil {
+		t.Fatal("expected the manifest write to fail")
+	}
+	if len(output.unrecorded) != 1 {
+		t.Fatalf("unrecorded = %d entries, want 1", len(output.unrecorded))
+	}
+
+	if err := os.Remove(manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := output.Flush(); err != nil {
+		t.Fatalf("retry flush: %v", err)
+	}
+
+	entries := readManifest(t, dir)
+	if len(entries) != 1 {
+		t.Fatalf("manifest has %d entries, want 1", len(entries))
+	}
+	if got := entries[0]; got.FirstID != "1-0" || got.LastID != "2-0" || got.Lines != 1 {
+		t.Errorf("entry = %+v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, entries[0].File)); err != nil {
+		t.Errorf("recorded file missing: %v", err)
+	}
+}
+
+func TestFileOutputClose(t *testing.T) {
+	setupPrometheusTest(t)
+	dir := t.TempDir()
+	output, err := newFileOutput(models.OutputModel{Name: "archive", Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := &Chunk{Lines: []string{"cpu usage=1 1700000000"}, IDs: []string{"1-0"}, Logger: global.Logger}
+	if err := output.Write(context.Background(), chunk); err != nil {
+		t.Fatal(err)
+	}
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-output.stop:
+	default:
+		t.Error("Close should stop the rotation ticker")
+	}
+	if output.file != nil {
+		t.Error("Close should close the current file")
+	}
+	if entries := readManifest(t, dir); len(entries) != 1 {
+		t.Errorf("manifest has %d entries, want 1", len(entries))
+	}
+}
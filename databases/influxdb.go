@@ -6,26 +6,15 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"go.uber.org/zap"
 )
 
-func InfluxdbConnectionAvailable() bool {
-	client := NewInfluxDBClient(time.Second)
-	ctx := context.Background()
-
-	_, err := client.Health(ctx)
-	if err != nil {
-		global.Logger.Error(err.Error(),
-			zap.Any(global.LogEvent.ConnectInfluxDB.Name, global.LogEvent.ConnectInfluxDB))
-		global.InfluxDB = client
-		return false
-	}
-	return true
-}
-
 func LoadInfluxDB() {
 	client := NewInfluxDBClient(time.Second)
 	ctx := context.Background()
@@ -44,9 +33,11 @@ func LoadInfluxDB() {
 }
 
 func NewInfluxDBClient(precision time.Duration) influxdb2.Client {
-	url := global.EnvConfig.Influxdb.URL
-	token := global.EnvConfig.Influxdb.Token
-	env := global.EnvConfig.Influxdb.Options
+	return newInfluxDBClient(global.Config().Influxdb.URL, global.Config().Influxdb.Token, precision)
+}
+
+func newInfluxDBClient(url, token string, precision time.Duration) influxdb2.Client {
+	env := global.Config().Influxdb.Options
 
 	influxdb := influxdb2.NewClientWithOptions(url, token,
 		influxdb2.DefaultOptions().
@@ -73,33 +64,91 @@ func NewInfluxDBClient(precision time.Duration) influxdb2.Client {
 	return influxdb
 }
 
-// * 寫入 InfluxDB
-func WriteLineProtocol(data []string) error {
+var telemetryClient struct {
+	sync.Once
+	client influxdb2.Client
+}
 
-	db := global.EnvConfig.Influxdb
-	client := NewInfluxDBClient(time.Second)
-	writeAPI := client.WriteAPIBlocking(db.Org, db.Bucket)
+// * 寫入自我遙測資料點到指定 bucket，必要輸出端的斷路器開啟時直接略過
+func WriteTelemetry(bucket string, points ...*write.Point) error {
+	if requiredOutputOpen() {
+		return ErrCircuitOpen
+	}
 
-	if err := writeAPI.WriteRecord(context.Background(), strings.Join(data, "\n")); err != nil {
-		global.Logger.Error(fmt.Sprintf("WriteToInfluxDB Error: %v", err),
-			zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
-		return err
+	db := global.Config().Influxdb
+	telemetryClient.Do(func() {
+		telemetryClient.client = newInfluxDBClient(db.URL, db.Token, time.Second)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return telemetryClient.client.WriteAPIBlocking(db.Org, bucket).WritePoint(ctx, points...)
+}
+
+// 任何必要輸出端的斷路器開啟時，influxdb 區塊的連線多半也無法使用
+func requiredOutputOpen() bool {
+	for _, runner := range outputs {
+		if state, _, _ := runner.breaker.State(); runner.required && state == stateOpen {
+			return true
+		}
 	}
+	return false
+}
 
-	return nil
+// influxOutput 為 InfluxDB v2 輸出端，每個輸出端持有自己的 client
+type influxOutput struct {
+	name     string
+	client   influxdb2.Client
+	writeAPI api.WriteAPIBlocking
+}
+
+func newInfluxOutput(cfg models.OutputModel) *influxOutput {
+	db := global.Config().Influxdb
+	if cfg.URL == "" {
+		cfg.URL = db.URL
+	}
+	if cfg.Token == "" {
+		cfg.Token = db.Token
+	}
+	if cfg.Org == "" {
+		cfg.Org = db.Org
+	}
+	if cfg.Bucket == "" {
+		cfg.Bucket = db.Bucket
+	}
+
+	client := newInfluxDBClient(cfg.URL, cfg.Token, time.Second)
+	return &influxOutput{
+		name:     cfg.Name,
+		client:   client,
+		writeAPI: client.WriteAPIBlocking(cfg.Org, cfg.Bucket),
+	}
+}
+
+func (o *influxOutput) Name() string {
+	return o.name
+}
+
+func (o *influxOutput) Health(ctx context.Context) error {
+	_, err := o.client.Health(ctx)
+	return err
+}
+
+func (o *influxOutput) Write(ctx context.Context, chunk *Chunk) error {
+	return o.writeAPI.WriteRecord(ctx, strings.Join(chunk.Lines, "\n"))
 }
 
 // * 寫入 InfluxDB
 func WriteToInfluxDB(data []models.Point) error {
 	points := []string{}
 
-	db := global.EnvConfig.Influxdb
+	db := global.Config().Influxdb
 	client := NewInfluxDBClient(time.Second)
 	writeAPI := client.WriteAPIBlocking(db.Org, db.Bucket)
 
 	for _, line := range data {
 		points = append(points, toLineProtocol(line))
-		if global.EnvConfig.Log.Level == "error" {
+		if global.Config().Log.Level == "error" {
 			fmt.Printf("%v\n", toLineProtocol(line))
 		}
 	}
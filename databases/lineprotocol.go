@@ -0,0 +1,69 @@
+package databases
+
+import (
+	"errors"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+)
+
+// 與 NewInfluxDBClient 使用相同的時間戳精度
+const linePrecision = lineprotocol.Second
+
+// linePoint 解析後的 line protocol 資料點
+type linePoint struct {
+	Measurement string
+	Tags        [][2]string
+	Fields      []lineField
+	Time        time.Time
+}
+
+type lineField struct {
+	Key   string
+	Value lineprotocol.Value
+}
+
+// * 解析並驗證單行 line protocol，沒有時間戳時使用 defaultTime
+func parseLine(line string, defaultTime time.Time) (*linePoint, error) {
+	dec := lineprotocol.NewDecoderWithBytes([]byte(line))
+	if !dec.Next() {
+		return nil, errors.New("empty line")
+	}
+
+	measurement, err := dec.Measurement()
+	if err != nil {
+		return nil, err
+	}
+	point := &linePoint{Measurement: string(measurement)}
+
+	for {
+		key, value, err := dec.NextTag()
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			break
+		}
+		point.Tags = append(point.Tags, [2]string{string(key), string(value)})
+	}
+
+	for {
+		key, value, err := dec.NextField()
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			break
+		}
+		point.Fields = append(point.Fields, lineField{Key: string(key), Value: value})
+	}
+
+	if point.Time, err = dec.Time(linePrecision, defaultTime); err != nil {
+		return nil, err
+	}
+
+	if dec.Next() {
+		return nil, errors.New("unexpected data after line")
+	}
+	return point, nil
+}
@@ -0,0 +1,469 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"go-redis2influx/models"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Output 為資料輸出端的共同介面
+type Output interface {
+	Name() string
+	Write(ctx context.Context, chunk *Chunk) error
+}
+
+// healthChecker 為可選介面，實作的輸出端在斷路器開啟時會被探測健康狀態
+type healthChecker interface {
+	Health(ctx context.Context) error
+}
+
+// flusher 為可選介面，實作的輸出端在強制 flush 時被呼叫
+type flusher interface {
+	Flush() error
+}
+
+// closer 為可選介面，實作的輸出端在重新載入輸出端時被關閉，停止背景工作
+type closer interface {
+	Close() error
+}
+
+// outputRunner 包裝輸出端，best-effort 輸出端擁有自己的緩衝佇列和重試
+type outputRunner struct {
+	output     Output
+	required   bool
+	retryDelay int
+	queue      chan *Chunk
+	wake       chan struct{}
+	pending    atomic.Int64 // 佇列中和正在寫入的 chunk 數量，歸零時才算寫完
+	breaker    *circuitBreaker
+}
+
+var outputs []*outputRunner
+
+// OutputStatus 輸出端目前的斷路器狀態，供健康檢查和管理端點使用
+type OutputStatus struct {
+	Name      string    `json:"name"`
+	Required  bool      `json:"required"`
+	State     string    `json:"state"`
+	Available bool      `json:"available"`
+	Since     time.Time `json:"since"`
+	Queued    int       `json:"queued"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// * 依設定建立所有輸出端，未設定 outputs 時使用 influxdb 區塊作為唯一的必要輸出端
+// 必要輸出端無法建立或沒有任何必要輸出端時回傳錯誤，否則批次會在沒有寫入任何地方的情況下被確認並刪除
+func LoadOutputs() error {
+	closeOutputs()
+
+	cfgs := global.Config().Outputs
+	if len(cfgs) == 0 {
+		cfgs = []models.OutputModel{{Name: "influxdb", Type: "influxdb", Required: true}}
+	}
+
+	var errs []error
+	for _, cfg := range cfgs {
+		output, err := newOutput(cfg)
+		if err != nil {
+			global.Logger.Error(fmt.Sprintf("Failed to create output %s: %v", cfg.Name, err),
+				zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+			if cfg.Required {
+				errs = append(errs, fmt.Errorf("required output %s: %w", cfg.Name, err))
+			}
+			continue
+		}
+
+		var probe func(ctx context.Context) error
+		if checker, ok := output.(healthChecker); ok {
+			probe = checker.Health
+		}
+
+		runner := &outputRunner{
+			output:     output,
+			required:   cfg.Required,
+			retryDelay: cfg.RetryDelay,
+		}
+		runner.breaker = newCircuitBreaker(output.Name(), runner.baseDelay(), probe)
+		if !runner.required {
+			size := cfg.BufferSize
+			if size <= 0 {
+				size = 100
+			}
+			runner.queue = make(chan *Chunk, size)
+			runner.wake = make(chan struct{}, 1)
+			go runner.run()
+		}
+
+		outputs = append(outputs, runner)
+		global.Logger.Info(fmt.Sprintf("Output %s (%s) loaded, required: %v", output.Name(), cfg.Type, cfg.Required),
+			zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	for _, runner := range outputs {
+		if runner.required {
+			return nil
+		}
+	}
+	return fmt.Errorf("no required output configured, batches would be acknowledged without being written")
+}
+
+// 關閉目前的輸出端，重新載入時避免舊輸出端的背景工作繼續執行
+func closeOutputs() {
+	for _, runner := range outputs {
+		if c, ok := runner.output.(closer); ok {
+			if err := c.Close(); err != nil {
+				global.Logger.Error(fmt.Sprintf("Failed to close output %s: %v", runner.output.Name(), err),
+					zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+			}
+		}
+	}
+	outputs = nil
+}
+
+func newOutput(cfg models.OutputModel) (Output, error) {
+	if cfg.Type == "" {
+		cfg.Type = "influxdb"
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Type
+	}
+
+	switch cfg.Type {
+	case "influxdb":
+		return newInfluxOutput(cfg), nil
+	case "prometheus":
+		return newPrometheusOutput(cfg)
+	case "file":
+		return newFileOutput(cfg)
+	default:
+		return nil, fmt.Errorf("unknown output type %q", cfg.Type)
+	}
+}
+
+// * 將消息切分成 chunk 後寫入所有輸出端，回傳所有 chunk 都寫入成功的消息 ID
+// 必要輸出端全部成功才算該 chunk 成功，best-effort 輸出端不影響結果，logger 為帶有批次關聯 ID 的 child logger
+func WriteLineProtocol(logger *zap.Logger, messages []models.Message) ([]string, error) {
+	cfg := global.Config().Writer
+	maxLines, maxBytes, parallelism := cfg.MaxLines, cfg.MaxBytes, cfg.Parallelism
+	if maxLines <= 0 {
+		maxLines = 5000
+	}
+	if maxBytes <= 0 {
+		maxBytes = 10 * 1024 * 1024
+	}
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	chunks := splitChunks(messages, maxLines, maxBytes)
+	for _, chunk := range chunks {
+		chunk.Logger = logger
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	failed := make(map[string]bool)
+	sem := make(chan struct{}, parallelism)
+
+	for _, chunk := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c *Chunk) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := writeChunk(c); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				for _, id := range c.IDs {
+					failed[id] = true
+				}
+				mu.Unlock()
+			}
+		}(chunk)
+	}
+	wg.Wait()
+
+	written := make([]string, 0, len(messages))
+	for _, message := range messages {
+		if !failed[message.ID] {
+			written = append(written, message.ID)
+		}
+	}
+
+	if len(chunks) > 1 {
+		logger.Debug(fmt.Sprintf("Batch of %d messages split into %d chunks, %d failed", len(messages), len(chunks), len(errs)),
+			zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+	}
+
+	return written, errors.Join(errs...)
+}
+
+// 將單一 chunk 寫入所有輸出端，必要輸出端全部成功才回傳 nil
+// 失敗時回傳 *ClassifiedError，分類為最嚴重的輸出端錯誤，IDs 為 chunk 內的消息
+// 必要輸出端全部成功後才放進 best-effort 輸出端的佇列，失敗的 chunk 會整批重試，提早放入會重複寫入
+func writeChunk(chunk *Chunk) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed *ClassifiedError
+	var errs []error
+
+	for _, runner := range outputs {
+		if !runner.required {
+			continue
+		}
+
+		wg.Add(1)
+		go func(r *outputRunner) {
+			defer wg.Done()
+			if err := r.write(chunk); err != nil {
+				classified := Classify(r.output.Name(), err)
+				chunk.Logger.Error(fmt.Sprintf("Write to output %s Error (%s): %v", r.output.Name(), classified.Class, err),
+					zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+				mu.Lock()
+				if failed == nil || WorseClass(failed.Class, classified.Class) != failed.Class {
+					failed = classified
+				}
+				errs = append(errs, classified)
+				mu.Unlock()
+			}
+		}(runner)
+	}
+	wg.Wait()
+
+	if failed == nil {
+		for _, runner := range outputs {
+			if !runner.required {
+				runner.enqueue(chunk)
+			}
+		}
+		return nil
+	}
+	return &ClassifiedError{
+		Class:      failed.Class,
+		Source:     failed.Source,
+		Status:     failed.Status,
+		RetryAfter: failed.RetryAfter,
+		IDs:        chunk.IDs,
+		Err:        errors.Join(errs...),
+	}
+}
+
+// * 檢查所有必要輸出端的斷路器，只有斷路器開啟時才會探測 /health
+func InfluxdbConnectionAvailable() bool {
+	available := true
+	for _, runner := range outputs {
+		if runner.required && !runner.breaker.Ready() {
+			available = false
+		}
+	}
+	return available
+}
+
+// * 回傳所有輸出端的狀態，不會觸發健康探測
+func OutputStatuses() []OutputStatus {
+	statuses := make([]OutputStatus, 0, len(outputs))
+	for _, runner := range outputs {
+		state, since, err := runner.breaker.State()
+		status := OutputStatus{
+			Name:      runner.output.Name(),
+			Required:  runner.required,
+			State:     state.String(),
+			Available: state != stateOpen,
+			Since:     since,
+			Queued:    len(runner.queue),
+		}
+		if err != nil {
+			status.LastError = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// * 在 ctx 的期限內同時探測所有輸出端的健康狀態，不影響斷路器，未實作健康檢查的輸出端不在結果中
+func ProbeOutputs(ctx context.Context) map[string]error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := make(map[string]error, len(outputs))
+	for _, runner := range outputs {
+		checker, ok := runner.output.(healthChecker)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			err := checker.Health(ctx)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(runner.output.Name())
+	}
+	wg.Wait()
+	return results
+}
+
+// * 強制 flush：best-effort 輸出端立即重試佇列中的 chunk，實作 flusher 的輸出端寫出緩衝內容
+func Flush() error {
+	var errs []error
+	for _, runner := range outputs {
+		if runner.wake != nil {
+			select {
+			case runner.wake <- struct{}{}:
+			default:
+			}
+		}
+		if f, ok := runner.output.(flusher); ok {
+			if err := f.Flush(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", runner.output.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// * 強制 flush 後等待所有 best-effort 輸出端的佇列寫完 (成功或因資料錯誤丟棄)，超過 timeout 時回傳仍未寫完的輸出端
+// 結束程式前呼叫，避免佇列中的 chunk 隨程式結束而遺失
+func FlushAndWait(timeout time.Duration) error {
+	err := Flush()
+	deadline := time.Now().Add(timeout)
+	for {
+		var waiting []string
+		for _, runner := range outputs {
+			if n := runner.pending.Load(); n > 0 {
+				waiting = append(waiting, fmt.Sprintf("%s (%d chunks)", runner.output.Name(), n))
+			}
+		}
+		if len(waiting) == 0 {
+			return err
+		}
+		if !time.Now().Before(deadline) {
+			return errors.Join(err, fmt.Errorf("best-effort outputs not flushed within %v: %s", timeout, strings.Join(waiting, ", ")))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// * 距離下一次可以探測必要輸出端的等待時間
+func RetryDelay() time.Duration {
+	var delay time.Duration
+	for _, runner := range outputs {
+		if !runner.required {
+			continue
+		}
+		if wait := runner.breaker.Wait(); wait > delay {
+			delay = wait
+		}
+	}
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	return delay
+}
+
+// * 重新載入設定後套用 circuit_breaker 和 redis.retry_delay 到所有輸出端的斷路器
+func ReloadBreakers() {
+	for _, runner := range outputs {
+		runner.breaker.configure(runner.baseDelay())
+	}
+}
+
+// 斷路器退避起始值，輸出端未設定 retry_delay 時使用 redis.retry_delay
+func (r *outputRunner) baseDelay() time.Duration {
+	if r.retryDelay > 0 {
+		return time.Duration(r.retryDelay) * time.Second
+	}
+	return time.Duration(global.Config().Redis.RetryDelay) * time.Second
+}
+
+// 經由斷路器寫入，斷路器開啟時直接回傳錯誤，失敗時回傳 *ClassifiedError
+// 資料錯誤表示輸出端正常回應，不計入斷路器；限流時依 Retry-After 開啟斷路器
+func (r *outputRunner) write(chunk *Chunk) error {
+	if !r.breaker.Allow() {
+		return ErrCircuitOpen
+	}
+
+	start := time.Now()
+	if err := r.output.Write(context.Background(), chunk); err != nil {
+		metrics.WriteLatency.WithLabelValues(r.output.Name(), "error").Observe(time.Since(start).Seconds())
+		classified := Classify(r.output.Name(), err)
+		switch classified.Class {
+		case ClassBadData:
+			r.breaker.Success()
+		case ClassRateLimit:
+			r.breaker.Throttle(err, classified.RetryAfter)
+		default:
+			r.breaker.Failure(err)
+		}
+		return classified
+	}
+	metrics.WriteLatency.WithLabelValues(r.output.Name(), "success").Observe(time.Since(start).Seconds())
+	r.breaker.Success()
+	return nil
+}
+
+// 佇列已滿時丟棄最舊的 chunk，避免阻塞主要資料流
+func (r *outputRunner) enqueue(chunk *Chunk) {
+	r.pending.Add(1)
+	select {
+	case r.queue <- chunk:
+		return
+	default:
+	}
+
+	select {
+	case dropped := <-r.queue:
+		r.pending.Add(-1)
+		dropped.Logger.Warn(fmt.Sprintf("Output %s buffer full, dropped oldest chunk", r.output.Name()),
+			zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+	default:
+	}
+
+	select {
+	case r.queue <- chunk:
+	default:
+		r.pending.Add(-1)
+	}
+}
+
+// best-effort 輸出端依序寫入佇列中的 chunk，失敗時持續重試直到成功，資料錯誤的 chunk 重試也不會成功所以丟棄
+func (r *outputRunner) run() {
+	for chunk := range r.queue {
+		for {
+			err := r.write(chunk)
+			if err == nil {
+				break
+			}
+			if Classify(r.output.Name(), err).Class == ClassBadData {
+				chunk.Logger.Warn(fmt.Sprintf("Best-effort output %s rejected chunk of %d lines as bad data, dropped: %v", r.output.Name(), len(chunk.Lines), err),
+					zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+				break
+			}
+			if err != ErrCircuitOpen {
+				chunk.Logger.Warn(fmt.Sprintf("Best-effort output %s write failed, %d chunks queued, retrying: %v", r.output.Name(), len(r.queue), err),
+					zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+			}
+			select {
+			case <-r.wake:
+			case <-time.After(r.breaker.Wait() + 100*time.Millisecond):
+			}
+		}
+		r.pending.Add(-1)
+	}
+}
@@ -0,0 +1,61 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"testing"
+	"time"
+)
+
+// stubOutput 依序回傳 errs 中的錯誤，用完後一律成功
+type stubOutput struct {
+	name string
+	errs []error
+}
+
+func (o *stubOutput) Name() string {
+	return o.name
+}
+
+func (o *stubOutput) Write(ctx context.Context, chunk *Chunk) error {
+	if len(o.errs) == 0 {
+		return nil
+	}
+	err := o.errs[0]
+	o.errs = o.errs[1:]
+	return err
+}
+
+func TestWriteLineProtocolBestEffortAfterRequired(t *testing.T) {
+	setupPrometheusTest(t)
+	config := &models.EnvironmentModel{}
+	config.CircuitBreaker.FailureThreshold = 10
+	global.SetConfig(config)
+
+	required := &outputRunner{output: &stubOutput{name: "primary", errs: []error{errors.New("connection refused")}}, required: true}
+	required.breaker = newCircuitBreaker("primary", time.Second, nil)
+	bestEffort := &outputRunner{output: &stubOutput{name: "secondary"}, queue: make(chan *Chunk, 10)}
+	bestEffort.breaker = newCircuitBreaker("secondary", time.Second, nil)
+	outputs = []*outputRunner{required, bestEffort}
+	t.Cleanup(func() { outputs = nil })
+
+	messages := []models.Message{{ID: "1-0", Data: "cpu usage=1 1700000000"}}
+
+	// 必要輸出端失敗時批次會整批重試，best-effort 輸出端不能先收到
+	if _, err := WriteLineProtocol(global.Logger, messages); err == nil {
+		t.Fatal("expected the required output to fail")
+	}
+	if len(bestEffort.queue) != 0 {
+		t.Fatalf("best-effort output queued %d chunks before the required output succeeded", len(bestEffort.queue))
+	}
+
+	written, err := WriteLineProtocol(global.Logger, messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 1 || len(bestEffort.queue) != 1 {
+		t.Errorf("written %v, best-effort queued %d chunks, want 1 and 1", written, len(bestEffort.queue))
+	}
+}
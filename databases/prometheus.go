@@ -0,0 +1,276 @@
+package databases
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"go-redis2influx/models"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// prometheusOutput 將 line protocol 轉成 Prometheus remote-write 時間序列
+// 指標名稱為 measurement_field，tag 轉為 label
+type prometheusOutput struct {
+	name   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+type promLabel struct {
+	Name  string
+	Value string
+}
+
+type promSample struct {
+	Value     float64
+	Timestamp int64
+}
+
+type promSeries struct {
+	Labels  []promLabel
+	Samples []promSample
+}
+
+func newPrometheusOutput(cfg models.OutputModel) (*prometheusOutput, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("prometheus output requires url")
+	}
+
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	return &prometheusOutput{
+		name:   cfg.Name,
+		url:    cfg.URL,
+		token:  cfg.Token,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (o *prometheusOutput) Name() string {
+	return o.name
+}
+
+func (o *prometheusOutput) Write(ctx context.Context, chunk *Chunk) error {
+	series, rejected := toPromSeries(chunk.Lines, time.Now())
+	if rejected > 0 {
+		metrics.LinesRejected.WithLabelValues("prometheus_unconvertible").Add(float64(rejected))
+		chunk.Logger.Warn(fmt.Sprintf("Output %s skipped %d lines that cannot be converted to Prometheus samples", o.name, rejected),
+			zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+	}
+	if len(series) == 0 {
+		return nil
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if name := global.Config().Influxdb.Options.SetApplicationName; name != "" {
+		req.Header.Set("User-Agent", name)
+	}
+	if o.token != "" {
+		req.Header.Set("Authorization", "Bearer "+o.token)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		retryAfter := ParseRetryAfter(resp.Header.Get("Retry-After"))
+		return &ClassifiedError{
+			Class:      ClassifyStatus(resp.StatusCode, retryAfter),
+			Source:     o.name,
+			Status:     resp.StatusCode,
+			RetryAfter: retryAfter,
+			Err:        fmt.Errorf("remote write returned %s: %s", resp.Status, strings.TrimSpace(string(msg))),
+		}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// * 將 line protocol 轉成時間序列，相同 label 組合的樣本合併到同一序列
+// 字串欄位和無法解析的行會被略過並計入 rejected
+func toPromSeries(lines []string, now time.Time) ([]*promSeries, int) {
+	index := make(map[string]*promSeries)
+	var series []*promSeries
+	rejected := 0
+
+	for _, line := range lines {
+		point, err := parseLine(line, now)
+		if err != nil {
+			rejected++
+			continue
+		}
+
+		converted := 0
+		for _, field := range point.Fields {
+			value, ok := promValue(field.Value)
+			if !ok {
+				continue
+			}
+			converted++
+
+			labels := make([]promLabel, 0, len(point.Tags)+1)
+			labels = append(labels, promLabel{Name: "__name__", Value: promName(point.Measurement + "_" + field.Key)})
+			seen := map[string]bool{"__name__": true}
+			for _, tag := range point.Tags {
+				// 轉換後同名的 tag 只保留第一個，重複的 label 會被接收端以 400 拒絕
+				name := promLabelName(tag[0])
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				labels = append(labels, promLabel{Name: name, Value: tag[1]})
+			}
+			sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+			var key strings.Builder
+			for _, label := range labels {
+				key.WriteString(label.Name)
+				key.WriteByte(0)
+				key.WriteString(label.Value)
+				key.WriteByte(0)
+			}
+
+			s, ok := index[key.String()]
+			if !ok {
+				s = &promSeries{Labels: labels}
+				index[key.String()] = s
+				series = append(series, s)
+			}
+			s.Samples = append(s.Samples, promSample{Value: value, Timestamp: point.Time.UnixMilli()})
+		}
+
+		if converted == 0 {
+			rejected++
+		}
+	}
+
+	// remote-write 要求同一序列的樣本依時間排序
+	for _, s := range series {
+		sort.SliceStable(s.Samples, func(i, j int) bool { return s.Samples[i].Timestamp < s.Samples[j].Timestamp })
+	}
+	return series, rejected
+}
+
+func promValue(v lineprotocol.Value) (float64, bool) {
+	switch v.Kind() {
+	case lineprotocol.Float:
+		return v.FloatV(), true
+	case lineprotocol.Int:
+		return float64(v.IntV()), true
+	case lineprotocol.Uint:
+		return float64(v.UintV()), true
+	case lineprotocol.Bool:
+		if v.BoolV() {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// Prometheus 指標名稱只允許 [a-zA-Z0-9_:]，且不能以數字開頭
+func promName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// label 名稱只允許 [a-zA-Z0-9_]，不能以數字開頭，__ 開頭為 Prometheus 保留，加上 tag 前綴
+func promLabelName(name string) string {
+	var b strings.Builder
+	if strings.HasPrefix(name, "__") {
+		b.WriteString("tag")
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// 依 prometheus/prompb 的 WriteRequest 定義編碼 protobuf
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []*promSeries) []byte {
+	var buf []byte
+	for _, s := range series {
+		var ts []byte
+		for _, label := range s.Labels {
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, label.Name)
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, label.Value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, l)
+		}
+		for _, sample := range s.Samples {
+			var sm []byte
+			sm = protowire.AppendTag(sm, 1, protowire.Fixed64Type)
+			sm = protowire.AppendFixed64(sm, math.Float64bits(sample.Value))
+			sm = protowire.AppendTag(sm, 2, protowire.VarintType)
+			sm = protowire.AppendVarint(sm, uint64(sample.Timestamp))
+
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sm)
+		}
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	return buf
+}
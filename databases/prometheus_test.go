@@ -0,0 +1,291 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 以 httptest 模擬 remote-write 接收端，解碼 snappy + protobuf 後回傳收到的時間序列
+func newRemoteWriteReceiver(t *testing.T, status int, header map[string]string) (*httptest.Server, *[]*promSeries) {
+	t.Helper()
+	var received []*promSeries
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		raw, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Errorf("snappy decode: %v", err)
+		}
+		series, err := decodeWriteRequest(raw)
+		if err != nil {
+			t.Errorf("protobuf decode: %v", err)
+		}
+		received = append(received, series...)
+
+		for key, value := range header {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &received
+}
+
+func setupPrometheusTest(t *testing.T) {
+	t.Helper()
+	global.Logger = zap.NewNop()
+	global.SetConfig(&models.EnvironmentModel{})
+	global.LogEvent = &models.LogEvent{}
+}
+
+func TestPrometheusOutputWrite(t *testing.T) {
+	setupPrometheusTest(t)
+	server, received := newRemoteWriteReceiver(t, http.StatusNoContent, nil)
+	output, err := newPrometheusOutput(models.OutputModel{Name: "prom", URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := &Chunk{
+		Lines: []string{
+			"cpu,host=a,region=tw usage=2.5,idle=10i 1700000002",
+			"cpu,host=a,region=tw usage=1.5 1700000001",
+			"disk.io,host=b up=true,label=\"x\" 1700000003",
+		},
+		Logger: zap.NewNop(),
+	}
+	if err := output.Write(context.Background(), chunk); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	got := make(map[string]*promSeries)
+	for _, s := range *received {
+		got[seriesName(s)] = s
+	}
+
+	usage := got["cpu_usage"]
+	if usage == nil {
+		t.Fatalf("cpu_usage not received, got %v", keys(got))
+	}
+	wantLabels := []promLabel{{"__name__", "cpu_usage"}, {"host", "a"}, {"region", "tw"}}
+	if len(usage.Labels) != len(wantLabels) {
+		t.Fatalf("cpu_usage labels = %v, want %v", usage.Labels, wantLabels)
+	}
+	for i, label := range wantLabels {
+		if usage.Labels[i] != label {
+			t.Errorf("cpu_usage label %d = %v, want %v", i, usage.Labels[i], label)
+		}
+	}
+	// 同一序列的樣本依時間排序，line protocol 為秒，remote-write 為毫秒
+	wantSamples := []promSample{{1.5, 1700000001000}, {2.5, 1700000002000}}
+	if len(usage.Samples) != len(wantSamples) {
+		t.Fatalf("cpu_usage samples = %v, want %v", usage.Samples, wantSamples)
+	}
+	for i, sample := range wantSamples {
+		if usage.Samples[i] != sample {
+			t.Errorf("cpu_usage sample %d = %v, want %v", i, usage.Samples[i], sample)
+		}
+	}
+
+	if idle := got["cpu_idle"]; idle == nil || len(idle.Samples) != 1 || idle.Samples[0].Value != 10 {
+		t.Errorf("cpu_idle = %+v, want one sample of 10", idle)
+	}
+	// 不合法的字元轉成底線，bool 轉成 0/1，字串欄位略過
+	if up := got["disk_io_up"]; up == nil || up.Samples[0].Value != 1 || up.Samples[0].Timestamp != 1700000003000 {
+		t.Errorf("disk_io_up = %+v, want one sample of 1 at 1700000003000", up)
+	}
+	if _, ok := got["disk_io_label"]; ok {
+		t.Error("string field disk_io_label should not be converted")
+	}
+}
+
+func TestPrometheusOutputLabelNames(t *testing.T) {
+	setupPrometheusTest(t)
+	server, received := newRemoteWriteReceiver(t, http.StatusNoContent, nil)
+	output, err := newPrometheusOutput(models.OutputModel{Name: "prom", URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := &Chunk{
+		Lines:  []string{`cpu,host-name=a,host.name=b,__name__=x,0zone=z,rack:id=r1 usage=1 1700000000`},
+		Logger: zap.NewNop(),
+	}
+	if err := output.Write(context.Background(), chunk); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if len(*received) != 1 {
+		t.Fatalf("got %d series, want 1", len(*received))
+	}
+
+	// 名稱轉換後重複的 tag 只保留第一個，__ 開頭加上 tag 前綴，: 不允許出現在 label 名稱中
+	want := []promLabel{{"_0zone", "z"}, {"__name__", "cpu_usage"}, {"host_name", "a"}, {"rack_id", "r1"}, {"tag__name__", "x"}}
+	labels := (*received)[0].Labels
+	if len(labels) != len(want) {
+		t.Fatalf("labels = %v, want %v", labels, want)
+	}
+	for i, label := range want {
+		if labels[i] != label {
+			t.Errorf("label %d = %v, want %v", i, labels[i], label)
+		}
+	}
+}
+
+func TestPrometheusOutputErrorClass(t *testing.T) {
+	setupPrometheusTest(t)
+	tests := []struct {
+		name       string
+		status     int
+		header     map[string]string
+		class      ErrorClass
+		retryAfter time.Duration
+	}{
+		{"bad request", http.StatusBadRequest, nil, ClassBadData, 0},
+		{"unauthorized", http.StatusUnauthorized, nil, ClassAuth, 0},
+		{"not found", http.StatusNotFound, nil, ClassConfig, 0},
+		{"server error", http.StatusInternalServerError, nil, ClassTransient, 0},
+		{"unavailable", http.StatusServiceUnavailable, nil, ClassTransient, 0},
+		{"unavailable with retry-after", http.StatusServiceUnavailable, map[string]string{"Retry-After": "7"}, ClassRateLimit, 7 * time.Second},
+		{"too many requests", http.StatusTooManyRequests, map[string]string{"Retry-After": "30"}, ClassRateLimit, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newRemoteWriteReceiver(t, tt.status, tt.header)
+			output, err := newPrometheusOutput(models.OutputModel{Name: "prom", URL: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = output.Write(context.Background(), &Chunk{Lines: []string{"cpu usage=1 1700000000"}, Logger: zap.NewNop()})
+			var classified *ClassifiedError
+			if !errors.As(err, &classified) {
+				t.Fatalf("error %v is not a *ClassifiedError", err)
+			}
+			if classified.Class != tt.class || classified.Status != tt.status || classified.RetryAfter != tt.retryAfter {
+				t.Errorf("got class %s, status %d, retry-after %v; want %s, %d, %v",
+					classified.Class, classified.Status, classified.RetryAfter, tt.class, tt.status, tt.retryAfter)
+			}
+		})
+	}
+}
+
+// 依 prometheus/prompb 的 WriteRequest 定義解碼，與 encodeWriteRequest 對應
+func decodeWriteRequest(b []byte) ([]*promSeries, error) {
+	var series []*promSeries
+	err := decodeFields(b, func(num protowire.Number, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		s := &promSeries{}
+		err := decodeFields(v, func(num protowire.Number, v []byte) error {
+			switch num {
+			case 1:
+				var label promLabel
+				err := decodeFields(v, func(num protowire.Number, v []byte) error {
+					if num == 1 {
+						label.Name = string(v)
+					} else {
+						label.Value = string(v)
+					}
+					return nil
+				})
+				s.Labels = append(s.Labels, label)
+				return err
+			case 2:
+				sample, err := decodeSample(v)
+				s.Samples = append(s.Samples, sample)
+				return err
+			}
+			return nil
+		})
+		series = append(series, s)
+		return err
+	})
+	return series, err
+}
+
+// 逐一解碼 length-delimited 欄位
+func decodeFields(b []byte, fn func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if typ != protowire.BytesType {
+			return errors.New("unexpected wire type")
+		}
+		b = b[n:]
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeSample(b []byte) (promSample, error) {
+	var sample promSample
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return sample, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return sample, protowire.ParseError(n)
+			}
+			sample.Value = math.Float64frombits(v)
+			b = b[n:]
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return sample, protowire.ParseError(n)
+			}
+			sample.Timestamp = int64(v)
+			b = b[n:]
+		default:
+			return sample, errors.New("unexpected sample field")
+		}
+	}
+	return sample, nil
+}
+
+func seriesName(s *promSeries) string {
+	for _, label := range s.Labels {
+		if label.Name == "__name__" {
+			return label.Value
+		}
+	}
+	return ""
+}
+
+func keys(m map[string]*promSeries) string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
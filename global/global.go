@@ -2,6 +2,7 @@ package global
 
 import (
 	"go-redis2influx/models"
+	"sync/atomic"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/robfig/cron/v3"
@@ -9,9 +10,21 @@ import (
 )
 
 var (
-	EnvConfig *models.EnvironmentModel
-	InfluxDB  influxdb2.Client
-	Crontab   *cron.Cron
-	Logger    *zap.Logger
-	LogEvent  *models.LogEvent
+	InfluxDB influxdb2.Client
+	Crontab  *cron.Cron
+	Logger   *zap.Logger
+	LogEvent *models.LogEvent
 )
+
+// 設定在重新載入時整份替換，以原子指標保存，讀取端不需要加鎖
+var envConfig atomic.Pointer[models.EnvironmentModel]
+
+// * 回傳目前生效的設定，同一次處理中需要多個欄位時應只呼叫一次，避免讀到重新載入前後不同的設定
+func Config() *models.EnvironmentModel {
+	return envConfig.Load()
+}
+
+// * 替換目前生效的設定
+func SetConfig(config *models.EnvironmentModel) {
+	envConfig.Store(config)
+}
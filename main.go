@@ -1,18 +1,232 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"go-redis2influx/alerts"
+	"go-redis2influx/databases"
 	"go-redis2influx/services"
 	"go-redis2influx/utils"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"text/tabwriter"
+	"time"
 )
 
+// 建置時以 -ldflags "-X main.version=v1.2.3" 設定
+var version = "dev"
+
+const usage = `Usage: go-redis2influx [command] [flags]
+
+Commands:
+  run          consume the Redis stream and write to all outputs (default)
+  validate     check the config file and exit non-zero on errors
+  drain        re-write every message left in the stream, then delete it
+  inspect      print stream length, consumer group lag and pending messages
+  events       print the effective log event catalog (built-in defaults overridden by log.yml)
+  test-notify  send a test alert to every webhook receiver (or --receiver) and exit non-zero on failure
+  version      print version information
+
+Flags:
+`
+
+// 所有子指令共用的參數
+type options struct {
+	config    string
+	logLevel  string
+	once      bool
+	receiver  string
+	flushWait time.Duration
+}
+
 func main() {
+	command := "run"
+	args := os.Args[1:]
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	var opts options
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.StringVar(&opts.config, "config", "", "path to config.yml (default: ./config.yml or /etc/go-redis2influx/config.yml)")
+	flags.StringVar(&opts.logLevel, "log-level", "", "override log.level (error, info, debug)")
+	flags.BoolVar(&opts.once, "once", false, "run: process a single batch and exit")
+	flags.DurationVar(&opts.flushWait, "flush-timeout", 30*time.Second, "run --once, drain: how long to wait for best-effort outputs to write their queues before exiting")
+	flags.StringVar(&opts.receiver, "receiver", "", "test-notify: only notify the receiver with this name")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// validate 沿用原本以位置參數指定設定檔的用法
+	if opts.config == "" && flags.NArg() > 0 {
+		opts.config = flags.Arg(0)
+	}
+	if opts.logLevel != "" {
+		utils.OverrideConfig("log.level", opts.logLevel)
+	}
+
+	switch command {
+	case "run":
+		os.Exit(run(opts))
+	case "validate":
+		os.Exit(validate(opts.config))
+	case "drain":
+		os.Exit(drain(opts))
+	case "inspect":
+		os.Exit(inspect(opts))
+	case "events":
+		printEvents(opts)
+	case "test-notify":
+		os.Exit(testNotify(opts))
+	case "version":
+		printVersion()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+func run(opts options) int {
 	// 加載環境參數和初始化日誌系統
-	utils.LoadEnvironment()
+	utils.LoadEnvironment(opts.config)
 	utils.InitLogger()
 
+	// 建立所有輸出端，必要輸出端無法建立時拒絕啟動
+	if err := databases.LoadOutputs(); err != nil {
+		fmt.Fprintf(os.Stderr, "outputs: %v\n", err)
+		return 1
+	}
+
+	// 只處理一個批次後結束，適合 cron 或測試使用
+	if opts.once {
+		n, err := services.ReadRedisOnce()
+		// 結束前等待 best-effort 輸出端的佇列寫完，否則佇列中的資料會隨程式結束而遺失
+		if flushErr := databases.FlushAndWait(opts.flushWait); err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "processed %d messages: %v\n", n, err)
+			return 1
+		}
+		fmt.Printf("processed %d messages\n", n)
+		return 0
+	}
+
+	// 啟動事件門檻告警、webhook 通知和條件檢查
+	alerts.Start()
+	if err := alerts.StartWebhooks(); err != nil {
+		fmt.Fprintf(os.Stderr, "webhook receivers: %v\n", err)
+	}
+	services.StartConditions()
+
+	// 監看 config.yml，變更或收到 SIGHUP 時重新載入可在執行期間套用的設定
+	utils.WatchConfig(databases.ReloadBreakers)
+
+	// SIGUSR1 暫時將日誌等級調整為 debug，SIGUSR2 還原
+	utils.WatchLogLevelSignals()
+
+	// 啟動 /metrics 等 HTTP 端點
+	services.StartHTTPServer()
+
+	// 啟動積壓監控、自我遙測和事件日誌
+	services.StartMonitor()
+	services.StartTelemetry()
+	databases.StartEventLog()
+
 	// 啟動 Redis 消費者處理數據
 	go services.ReadRedisData()
 
 	// 阻塞主線程
 	select {}
 }
+
+func validate(path string) int {
+	unknown, err := utils.CheckConfigFile(path)
+	for _, key := range unknown {
+		fmt.Fprintf(os.Stderr, "warning: unknown config key %q\n", key)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config is invalid:\n%v\n", err)
+		return 1
+	}
+	fmt.Println("config is valid")
+	return 0
+}
+
+func drain(opts options) int {
+	utils.LoadEnvironment(opts.config)
+	utils.InitLogger()
+	if err := databases.LoadOutputs(); err != nil {
+		fmt.Fprintf(os.Stderr, "outputs: %v\n", err)
+		return 1
+	}
+
+	err := services.ProcessRemainingDataFromRedis()
+	if flushErr := databases.FlushAndWait(opts.flushWait); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "drain failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func inspect(opts options) int {
+	utils.LoadEnvironment(opts.config)
+	utils.InitLogger()
+
+	if err := services.Inspect(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func testNotify(opts options) int {
+	utils.LoadEnvironment(opts.config)
+	utils.InitLogger()
+
+	results, err := alerts.SendTest(opts.receiver)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	code := 0
+	for name, err := range results {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: ok\n", name)
+	}
+	return code
+}
+
+func printEvents(opts options) {
+	utils.LoadEnvironment(opts.config)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tNAME\tCODE\tCATEGORY\tLEVEL\tTHRESHOLD\tDESCRIPTION")
+	for _, e := range utils.EventCatalog() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Key, e.Name, e.Code, e.Category, e.Level, e.Threshold, e.Description)
+	}
+	w.Flush()
+}
+
+func printVersion() {
+	fmt.Printf("go-redis2influx %s (%s, %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.time" {
+				fmt.Printf("%s: %s\n", setting.Key, setting.Value)
+			}
+		}
+	}
+}
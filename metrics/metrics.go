@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "redis2influx"
+
+var (
+	Registry = prometheus.NewRegistry()
+
+	// Redis Stream 消息
+	MessagesRead = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_read_total",
+		Help:      "Messages read from the Redis stream.",
+	}, []string{"stream"})
+	MessagesWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_written_total",
+		Help:      "Messages written to all required outputs.",
+	}, []string{"stream"})
+	MessagesAcked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_acked_total",
+		Help:      "Messages acknowledged with XACK.",
+	}, []string{"stream"})
+	MessagesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_deleted_total",
+		Help:      "Messages deleted from the stream with XDEL.",
+	}, []string{"stream"})
+	MessagesQuarantined = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_quarantined_total",
+		Help:      "Messages moved to the dead-letter stream after an output rejected them as bad data.",
+	}, []string{"stream"})
+	LinesRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lines_rejected_total",
+		Help:      "Messages or lines that could not be written, by reason.",
+	}, []string{"reason"})
+	BatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_size_messages",
+		Help:      "Messages per batch read from Redis.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	})
+
+	// 輸出端
+	WriteLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "write_duration_seconds",
+		Help:      "Chunk write latency per output.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"output", "result"})
+	OutputState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "output_circuit_state",
+		Help:      "Output circuit breaker state: 0 closed (available), 1 open, 2 half-open.",
+	}, []string{"output"})
+
+	// 消費者群組積壓
+	StreamLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stream_length",
+		Help:      "Number of entries in the Redis stream (XINFO STREAM).",
+	}, []string{"stream"})
+	GroupLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "group_lag",
+		Help:      "Entries not yet delivered to the consumer group (Redis 7, -1 if unknown).",
+	}, []string{"stream", "group"})
+	PendingMessages = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_messages",
+		Help:      "Delivered but unacknowledged entries per consumer (XPENDING).",
+	}, []string{"stream", "group", "consumer"})
+	OldestPendingAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "oldest_pending_age_seconds",
+		Help:      "Age of the oldest pending entry, derived from its stream ID.",
+	}, []string{"stream", "group"})
+
+	// 告警
+	AlertsFiring = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "alert_firing",
+		Help:      "1 while the alert for a log event code is firing.",
+	}, []string{"code"})
+
+	// Redis 錯誤，依 LogEvent 代碼分類
+	RedisErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_errors_total",
+		Help:      "Redis command errors by log event code.",
+	}, []string{"code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		MessagesRead,
+		MessagesWritten,
+		MessagesAcked,
+		MessagesDeleted,
+		MessagesQuarantined,
+		LinesRejected,
+		BatchSize,
+		WriteLatency,
+		OutputState,
+		StreamLength,
+		GroupLag,
+		PendingMessages,
+		OldestPendingAge,
+		AlertsFiring,
+		RedisErrors,
+	)
+}
+
+// Totals 目前累計的指標值，供自我遙測計算區間差值
+type Totals struct {
+	Read         float64
+	Written      float64
+	Acked        float64
+	Rejected     float64 // 輸出端略過的行數加上移到 dead-letter stream 的消息數
+	RedisErrors  float64
+	WriteErrors  float64
+	WriteCount   float64
+	WriteSeconds float64
+}
+
+// * 從 Registry 彙總指標，stream 為空時彙總所有 stream
+func Snapshot(stream string) Totals {
+	var totals Totals
+
+	families, err := Registry.Gather()
+	if err != nil {
+		return totals
+	}
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if s, ok := labels["stream"]; ok && stream != "" && s != stream {
+				continue
+			}
+
+			switch family.GetName() {
+			case namespace + "_messages_read_total":
+				totals.Read += metric.GetCounter().GetValue()
+			case namespace + "_messages_written_total":
+				totals.Written += metric.GetCounter().GetValue()
+			case namespace + "_messages_acked_total":
+				totals.Acked += metric.GetCounter().GetValue()
+			case namespace + "_lines_rejected_total", namespace + "_messages_quarantined_total":
+				totals.Rejected += metric.GetCounter().GetValue()
+			case namespace + "_redis_errors_total":
+				totals.RedisErrors += metric.GetCounter().GetValue()
+			case namespace + "_write_duration_seconds":
+				h := metric.GetHistogram()
+				if labels["result"] == "error" {
+					totals.WriteErrors += float64(h.GetSampleCount())
+					continue
+				}
+				totals.WriteCount += float64(h.GetSampleCount())
+				totals.WriteSeconds += h.GetSampleSum()
+			}
+		}
+	}
+	return totals
+}
@@ -3,6 +3,7 @@ package models
 type EnvironmentModel struct {
 	Redis struct {
 		Address      string `mapstructure:"address"`
+		Password     string `mapstructure:"password"`
 		DB           int    `mapstructure:"db"`
 		GroupName    string `mapstructure:"group_name"`
 		ConsumerName string `mapstructure:"consumer_name"`
@@ -11,13 +12,28 @@ type EnvironmentModel struct {
 		Count        int    `mapstructure:"count"`
 		BlockMs      int    `mapstructure:"block_ms"`
 		RetryDelay   int    `mapstructure:"retry_delay"`
+
+		DeadLetterStream string `mapstructure:"dead_letter_stream"`
 	}
 
 	Log struct {
-		Level   string `mapstructure:"level"`
-		Path    string `mapstructure:"path"`
-		MaxSize int    `mapstructure:"maxsize"`
-		MaxAge  int    `mapstructure:"maxage"`
+		Level         string `mapstructure:"level"`
+		Path          string `mapstructure:"path"`
+		Filename      string `mapstructure:"filename"`
+		MaxSize       int    `mapstructure:"maxsize"`
+		MaxAge        int    `mapstructure:"maxage"`
+		MaxBackups    int    `mapstructure:"maxbackups"`
+		Compress      bool   `mapstructure:"compress"`
+		LocalTime     bool   `mapstructure:"localtime"`
+		Rotate        string `mapstructure:"rotate"`
+		MinFreeMB     int    `mapstructure:"min_free_mb"`
+		DedupInterval int    `mapstructure:"dedup_interval"`
+		LevelTimeout  int    `mapstructure:"level_timeout"`
+		Format        struct {
+			Console string `mapstructure:"console"`
+			File    string `mapstructure:"file"`
+		} `mapstructure:"format"`
+		Sinks []LogSinkModel `mapstructure:"sinks"`
 	}
 
 	Influxdb struct {
@@ -37,4 +53,112 @@ type EnvironmentModel struct {
 			SetApplicationName    string `mapstructure:"set_application_name"`
 		} `mapstructure:"options"`
 	}
+
+	Outputs []OutputModel `mapstructure:"outputs"`
+
+	Writer struct {
+		MaxLines    int `mapstructure:"max_lines"`
+		MaxBytes    int `mapstructure:"max_bytes"`
+		Parallelism int `mapstructure:"parallelism"`
+	} `mapstructure:"writer"`
+
+	HTTP struct {
+		Address string `mapstructure:"address"`
+	} `mapstructure:"http"`
+
+	Admin struct {
+		Token string `mapstructure:"token"`
+	} `mapstructure:"admin"`
+
+	Health struct {
+		MaxHeartbeatAge int `mapstructure:"max_heartbeat_age"`
+		Timeout         int `mapstructure:"timeout"`
+	} `mapstructure:"health"`
+
+	Telemetry struct {
+		Interval int    `mapstructure:"interval"`
+		Bucket   string `mapstructure:"bucket"`
+		Instance string `mapstructure:"instance"`
+	} `mapstructure:"telemetry"`
+
+	Events struct {
+		Bucket        string `mapstructure:"bucket"`
+		Measurement   string `mapstructure:"measurement"`
+		Level         string `mapstructure:"level"`
+		BufferSize    int    `mapstructure:"buffer_size"`
+		FlushInterval int    `mapstructure:"flush_interval"`
+	} `mapstructure:"events"`
+
+	Monitor struct {
+		Interval           int   `mapstructure:"interval"`
+		LagWarn            int64 `mapstructure:"lag_warn"`
+		LagError           int64 `mapstructure:"lag_error"`
+		PendingWarn        int64 `mapstructure:"pending_warn"`
+		PendingError       int64 `mapstructure:"pending_error"`
+		OldestPendingWarn  int64 `mapstructure:"oldest_pending_warn"`
+		OldestPendingError int64 `mapstructure:"oldest_pending_error"`
+	} `mapstructure:"monitor"`
+
+	Notify struct {
+		InfluxDownMinutes   int             `mapstructure:"influx_down_minutes"`
+		PendingGrowthChecks int             `mapstructure:"pending_growth_checks"`
+		RejectedPerMinute   int             `mapstructure:"rejected_per_minute"`
+		Receivers           []ReceiverModel `mapstructure:"receivers"`
+	} `mapstructure:"notify"`
+
+	CircuitBreaker struct {
+		FailureThreshold int `mapstructure:"failure_threshold"`
+		MaxDelay         int `mapstructure:"max_delay"`
+	} `mapstructure:"circuit_breaker"`
+}
+
+// OutputModel 單一輸出端設定，未設定的 InfluxDB 連線參數沿用 influxdb 區塊
+type OutputModel struct {
+	Name       string `mapstructure:"name"`
+	Type       string `mapstructure:"type"`
+	Required   bool   `mapstructure:"required"`
+	BufferSize int    `mapstructure:"buffer_size"`
+	RetryDelay int    `mapstructure:"retry_delay"`
+	URL        string `mapstructure:"url"`
+	Token      string `mapstructure:"token"`
+	Org        string `mapstructure:"org"`
+	Bucket     string `mapstructure:"bucket"`
+	Timeout    int    `mapstructure:"timeout"`
+	Path       string `mapstructure:"path"`
+	Rotate     string `mapstructure:"rotate"`
+	MaxSize    int    `mapstructure:"maxsize"`
+	Gzip       bool   `mapstructure:"gzip"`
+}
+
+// LogSinkModel 單一日誌輸出設定，未設定 log.sinks 時依 log.format 建立 console 和 file 兩個輸出
+type LogSinkModel struct {
+	Name       string `mapstructure:"name"`
+	Type       string `mapstructure:"type"`
+	Level      string `mapstructure:"level"`
+	MaxLevel   string `mapstructure:"max_level"`
+	Format     string `mapstructure:"format"`
+	Path       string `mapstructure:"path"`
+	MaxSize    int    `mapstructure:"maxsize"`
+	MaxAge     int    `mapstructure:"maxage"`
+	MaxBackups int    `mapstructure:"maxbackups"`
+	Rotate     string `mapstructure:"rotate"`
+	Compress   *bool  `mapstructure:"compress"`  // 未設定時沿用 log.compress
+	LocalTime  *bool  `mapstructure:"localtime"` // 未設定時沿用 log.localtime
+	Network    string `mapstructure:"network"`
+	Address    string `mapstructure:"address"`
+	Tag        string `mapstructure:"tag"`
+}
+
+// ReceiverModel 單一 webhook 接收端設定
+type ReceiverModel struct {
+	Name       string            `mapstructure:"name"`
+	URL        string            `mapstructure:"url"`
+	Template   string            `mapstructure:"template"`
+	Headers    map[string]string `mapstructure:"headers"`
+	Events     []string          `mapstructure:"events"`
+	Statuses   []string          `mapstructure:"statuses"`
+	Retries    *int              `mapstructure:"retries"` // 未設定時為 3，0 表示不重試
+	RetryDelay int               `mapstructure:"retry_delay"`
+	RateLimit  int               `mapstructure:"rate_limit"`
+	Timeout    int               `mapstructure:"timeout"`
 }
@@ -13,6 +13,8 @@ type LogEvent struct {
 	// InfluxDB Events
 	OutputInfluxDB  Event `mapstructure:"output_influxdb"`
 	ConnectInfluxDB Event `mapstructure:"connect_influxdb"`
+	CircuitBreaker  Event `mapstructure:"circuit_breaker"`
+	InfluxDBDown    Event `mapstructure:"influxdb_down"`
 
 	// Logger Event
 	LoggerWrite Event `mapstructure:"logger_write"`
@@ -20,6 +22,20 @@ type LogEvent struct {
 	// Configuration Event
 	LoadEnvConfig Event `mapstructure:"load_env_config"`
 
+	// HTTP Events
+	HTTPServer Event `mapstructure:"http_server"`
+	AdminAPI   Event `mapstructure:"admin_api"`
+
+	// Alerting Events
+	Alerting       Event `mapstructure:"alerting"`
+	Webhook        Event `mapstructure:"webhook"`
+	RejectedSpike  Event `mapstructure:"rejected_spike"`
+	QuarantineData Event `mapstructure:"quarantine_data"`
+
+	// Telemetry Events
+	SelfTelemetry Event `mapstructure:"self_telemetry"`
+	EventLog      Event `mapstructure:"event_log"`
+
 	// Redis Events
 	ConnectRedis        Event `mapstructure:"connect_redis"`
 	ReadRedisStream     Event `mapstructure:"read_redis_stream"`
@@ -29,4 +45,7 @@ type LogEvent struct {
 	ReconnectRedis      Event `mapstructure:"reconnect_redis"`
 	RedisWrite          Event `mapstructure:"redis_write"`
 	RedisGroupCreate    Event `mapstructure:"redis_group_create"`
+	StreamMonitor       Event `mapstructure:"stream_monitor"`
+	PendingGrowth       Event `mapstructure:"pending_growth"`
+	ConsumerStopped     Event `mapstructure:"consumer_stopped"`
 }
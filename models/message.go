@@ -0,0 +1,7 @@
+package models
+
+// Message 從 Redis Stream 讀取的一筆消息，Data 可能包含多行 line protocol
+type Message struct {
+	ID   string
+	Data string
+}
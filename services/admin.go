@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"go-redis2influx/databases"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"go-redis2influx/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// BatchState 目前批次的狀態，供 /admin/batch 回報
+type BatchState struct {
+	Stream    string     `json:"stream"`
+	Paused    bool       `json:"paused"`
+	PausedAt  *time.Time `json:"paused_at,omitempty"`
+	StoppedBy string     `json:"stopped_by,omitempty"`
+	Stage     string     `json:"stage"`
+	Batch     string     `json:"batch,omitempty"`
+	Attempt   int        `json:"attempt,omitempty"`
+	Messages  int        `json:"messages"`
+	FirstID   string     `json:"first_id,omitempty"`
+	LastID    string     `json:"last_id,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+type drainResult struct {
+	Drained int    `json:"drained"`
+	Error   string `json:"error,omitempty"`
+}
+
+// consumerControl 管理端點對單一 stream 消費迴圈的控制，迴圈在兩次迭代之間檢查
+type consumerControl struct {
+	mu     sync.Mutex
+	state  BatchState
+	resume chan struct{}
+	drain  chan chan drainResult
+}
+
+var controls = struct {
+	sync.Mutex
+	streams map[string]*consumerControl
+}{streams: make(map[string]*consumerControl)}
+
+func consumerFor(stream string) *consumerControl {
+	controls.Lock()
+	defer controls.Unlock()
+
+	control, ok := controls.streams[stream]
+	if !ok {
+		control = &consumerControl{
+			state:  BatchState{Stream: stream, Stage: "idle"},
+			resume: make(chan struct{}, 1),
+			drain:  make(chan chan drainResult),
+		}
+		controls.streams[stream] = control
+	}
+	return control
+}
+
+// serve 處理等待中的清空請求，暫停時阻塞直到恢復，期間持續更新心跳並回應清空請求
+func (c *consumerControl) serve(ctx context.Context, rdb *redis.Client) {
+	for {
+		if !c.isPaused() {
+			select {
+			case reply := <-c.drain:
+				c.runDrain(ctx, rdb, reply)
+				continue
+			default:
+				return
+			}
+		}
+
+		consumerHealth.beat()
+		select {
+		case <-c.resume:
+		case reply := <-c.drain:
+			// 暫停期間仍允許手動清空
+			c.runDrain(ctx, rdb, reply)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (c *consumerControl) runDrain(ctx context.Context, rdb *redis.Client, reply chan drainResult) {
+	n, err := drainPending(ctx, rdb, c)
+	result := drainResult{Drained: n}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	global.Logger.Info(fmt.Sprintf("Drained %d pending messages from %s", n, c.snapshot().Stream),
+		zap.Any(global.LogEvent.AdminAPI.Name, global.LogEvent.AdminAPI))
+	reply <- result
+}
+
+func (c *consumerControl) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Paused
+}
+
+func (c *consumerControl) setPaused(paused bool) {
+	c.mu.Lock()
+	c.state.Paused = paused
+	c.state.PausedAt = nil
+	if paused {
+		now := time.Now()
+		c.state.PausedAt = &now
+	}
+	c.mu.Unlock()
+
+	if !paused {
+		select {
+		case c.resume <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *consumerControl) begin(batch string, attempt int, messages []models.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.state.Stage = "writing"
+	c.state.Batch = batch
+	c.state.Attempt = attempt
+	c.state.Messages = len(messages)
+	c.state.FirstID = messages[0].ID
+	c.state.LastID = messages[len(messages)-1].ID
+	c.state.StartedAt = &now
+}
+
+func (c *consumerControl) stage(stage string) {
+	c.mu.Lock()
+	c.state.Stage = stage
+	c.mu.Unlock()
+}
+
+func (c *consumerControl) fail(err error) {
+	c.mu.Lock()
+	c.state.LastError = fmt.Sprintf("%s: %v", time.Now().Format(time.RFC3339), err)
+	c.mu.Unlock()
+}
+
+func (c *consumerControl) end() {
+	c.mu.Lock()
+	c.state.Stage = "idle"
+	c.mu.Unlock()
+}
+
+func (c *consumerControl) snapshot() BatchState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// * 註冊管理端點，admin.token 未設定時不啟用
+//
+//	POST /admin/streams/{stream}/pause
+//	POST /admin/streams/{stream}/resume
+//	POST /admin/drain[?stream=]
+//	POST /admin/flush
+//	GET  /admin/batch
+//	GET  /admin/loglevel
+//	POST /admin/loglevel?level=debug[&sink=名稱][&timeout=秒]
+//	POST /admin/loglevel/reset[?sink=]
+func registerAdminHandlers(mux *http.ServeMux) {
+	if global.Config().Admin.Token == "" {
+		return
+	}
+
+	mux.HandleFunc("/admin/streams/", adminAuth(http.MethodPost, adminStreamHandler))
+	mux.HandleFunc("/admin/drain", adminAuth(http.MethodPost, adminDrainHandler))
+	mux.HandleFunc("/admin/flush", adminAuth(http.MethodPost, adminFlushHandler))
+	mux.HandleFunc("/admin/batch", adminAuth(http.MethodGet, adminBatchHandler))
+	mux.HandleFunc("/admin/loglevel", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			adminAuth(http.MethodGet, adminLogLevelsHandler)(w, r)
+			return
+		}
+		adminAuth(http.MethodPost, adminSetLogLevelHandler)(w, r)
+	})
+	mux.HandleFunc("/admin/loglevel/reset", adminAuth(http.MethodPost, adminResetLogLevelHandler))
+}
+
+// 以 Bearer token 驗證，並限制 HTTP method
+func adminAuth(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(global.Config().Admin.Token)) != 1 {
+			global.Logger.Warn(fmt.Sprintf("Rejected unauthenticated admin request %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr),
+				zap.Any(global.LogEvent.AdminAPI.Name, global.LogEvent.AdminAPI))
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if r.Method != method {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func adminStreamHandler(w http.ResponseWriter, r *http.Request) {
+	stream, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/streams/"), "/")
+
+	controls.Lock()
+	control, ok := controls.streams[stream]
+	controls.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("unknown stream %q", stream)})
+		return
+	}
+
+	switch action {
+	case "pause":
+		control.setPaused(true)
+	case "resume":
+		control.resumeStopped()
+		control.setPaused(false)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("unknown action %q", action)})
+		return
+	}
+
+	global.Logger.Info(fmt.Sprintf("Consumer for stream %s %sd by admin API", stream, action),
+		zap.Any(global.LogEvent.AdminAPI.Name, global.LogEvent.AdminAPI))
+	writeJSON(w, http.StatusOK, control.snapshot())
+}
+
+// 清空請求由消費迴圈在兩次迭代之間執行，等待結果直到請求結束
+func adminDrainHandler(w http.ResponseWriter, r *http.Request) {
+	results := make(map[string]drainResult)
+
+	controls.Lock()
+	targets := make(map[string]*consumerControl)
+	for stream, control := range controls.streams {
+		if s := r.URL.Query().Get("stream"); s == "" || s == stream {
+			targets[stream] = control
+		}
+	}
+	controls.Unlock()
+
+	status := http.StatusOK
+	for stream, control := range targets {
+		reply := make(chan drainResult, 1)
+		select {
+		case control.drain <- reply:
+		case <-r.Context().Done():
+			writeJSON(w, http.StatusGatewayTimeout, map[string]string{"error": "consumer busy"})
+			return
+		}
+
+		select {
+		case result := <-reply:
+			results[stream] = result
+			if result.Error != "" {
+				status = http.StatusBadGateway
+			}
+		case <-r.Context().Done():
+			writeJSON(w, http.StatusAccepted, map[string]string{"status": "drain still running"})
+			return
+		}
+	}
+	writeJSON(w, status, results)
+}
+
+func adminFlushHandler(w http.ResponseWriter, r *http.Request) {
+	global.Logger.Info("Flush requested by admin API",
+		zap.Any(global.LogEvent.AdminAPI.Name, global.LogEvent.AdminAPI))
+
+	if err := databases.Flush(); err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "flushed"})
+}
+
+func adminBatchHandler(w http.ResponseWriter, r *http.Request) {
+	controls.Lock()
+	batches := make([]BatchState, 0, len(controls.streams))
+	for _, control := range controls.streams {
+		batches = append(batches, control.snapshot())
+	}
+	controls.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"batches": batches,
+		"outputs": databases.OutputStatuses(),
+	})
+}
+
+func adminLogLevelsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, utils.LogLevels())
+}
+
+// 暫時調整日誌等級，到時自動還原為 log.level，timeout 未設定時使用 log.level_timeout
+func adminSetLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var timeout time.Duration
+	if s := query.Get("timeout"); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil || seconds <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("timeout %q must be a positive number of seconds", s)})
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	levels, err := utils.OverrideLogLevel(query.Get("sink"), query.Get("level"), timeout)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, levels)
+}
+
+func adminResetLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	levels, err := utils.ResetLogLevel(r.URL.Query().Get("sink"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, levels)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
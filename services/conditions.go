@@ -0,0 +1,131 @@
+package services
+
+import (
+	"fmt"
+	"go-redis2influx/alerts"
+	"go-redis2influx/databases"
+	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"strings"
+	"time"
+)
+
+// 條件檢查的間隔
+const conditionInterval = 15 * time.Second
+
+// pendingTrend 記錄 PEL 連續增長的次數，只在監控結果更新時計算
+type pendingTrend struct {
+	checkedAt time.Time
+	pending   int64
+	growth    int
+}
+
+// * 啟動告警條件檢查：必要輸出端持續無法使用、PEL 持續增長、被拒絕的行數突增，門檻為 0 時不檢查
+func StartConditions() {
+	cfg := global.Config().Notify
+	if cfg.InfluxDownMinutes <= 0 && cfg.PendingGrowthChecks <= 0 && cfg.RejectedPerMinute <= 0 {
+		return
+	}
+
+	go func() {
+		trends := make(map[string]*pendingTrend)
+		prev, prevTime := metrics.Snapshot(""), time.Now()
+
+		for now := range time.Tick(conditionInterval) {
+			if cfg.InfluxDownMinutes > 0 {
+				checkOutputsDown(now, time.Duration(cfg.InfluxDownMinutes)*time.Minute)
+			}
+			if cfg.PendingGrowthChecks > 0 {
+				checkPendingGrowth(trends, cfg.PendingGrowthChecks)
+			}
+			if cfg.RejectedPerMinute > 0 {
+				current := metrics.Snapshot("")
+				checkRejectedRate(current.Rejected-prev.Rejected, now.Sub(prevTime), cfg.RejectedPerMinute)
+				prev, prevTime = current, now
+			}
+		}
+	}()
+}
+
+// 任何必要輸出端的斷路器開啟超過 limit 時觸發，全部恢復後解除
+func checkOutputsDown(now time.Time, limit time.Duration) {
+	var down []string
+	for _, output := range databases.OutputStatuses() {
+		if output.Required && !output.Available && now.Sub(output.Since) >= limit {
+			down = append(down, fmt.Sprintf("%s unavailable for %v (%s)", output.Name, now.Sub(output.Since).Round(time.Second), output.LastError))
+		}
+	}
+
+	message := "All required outputs are available"
+	if len(down) > 0 {
+		message = strings.Join(down, "; ")
+	}
+	alerts.Set(global.LogEvent.InfluxDBDown, len(down) > 0, len(down), message)
+}
+
+// PEL 在連續 checks 次監控結果中持續增長時觸發，PEL 減少時解除
+func checkPendingGrowth(trends map[string]*pendingTrend, checks int) {
+	var growing []string
+	var total int64
+	changed := false
+
+	for _, stream := range streamKeys() {
+		backlogs.RLock()
+		backlog, ok := backlogs.streams[stream]
+		backlogs.RUnlock()
+		if !ok {
+			continue
+		}
+
+		trend, ok := trends[stream]
+		if !ok {
+			trends[stream] = &pendingTrend{checkedAt: backlog.CheckedAt, pending: backlog.Pending}
+			continue
+		}
+		if !backlog.CheckedAt.After(trend.checkedAt) {
+			if trend.growth >= checks {
+				growing = append(growing, stream)
+			}
+			continue
+		}
+
+		changed = true
+		switch {
+		case backlog.Pending > trend.pending:
+			trend.growth++
+		case backlog.Pending < trend.pending:
+			trend.growth = 0
+		}
+		trend.checkedAt, trend.pending = backlog.CheckedAt, backlog.Pending
+		total += backlog.Pending
+
+		if trend.growth >= checks {
+			growing = append(growing, fmt.Sprintf("%s (%d pending, grew %d checks in a row)", stream, backlog.Pending, trend.growth))
+		}
+	}
+
+	if !changed {
+		return
+	}
+	message := "Pending entries list is no longer growing"
+	if len(growing) > 0 {
+		message = "Pending entries list keeps growing: " + strings.Join(growing, "; ")
+	}
+	alerts.Set(global.LogEvent.PendingGrowth, len(growing) > 0, int(total), message)
+}
+
+// 每分鐘被拒絕的行數 (包含移到 dead-letter stream 的消息) 超過 limit 時觸發，降到一半以下時解除
+func checkRejectedRate(rejected float64, elapsed time.Duration, limit int) {
+	if elapsed <= 0 {
+		return
+	}
+	perMinute := rejected / elapsed.Minutes()
+	message := fmt.Sprintf("%.0f rejected lines or quarantined messages per minute (limit %d)", perMinute, limit)
+
+	switch {
+	case perMinute > float64(limit):
+		alerts.Set(global.LogEvent.RejectedSpike, true, int(rejected), message)
+	case perMinute <= float64(limit)/2:
+		alerts.Set(global.LogEvent.RejectedSpike, false, int(rejected), message)
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-redis2influx/alerts"
+	"go-redis2influx/databases"
+	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// * Redis 錯誤分類：NOAUTH、WRONGPASS、NOPERM 為認證錯誤，stream_key 不是 stream (WRONGTYPE) 或伺服器不支援 stream 指令為設定錯誤
+// 其他錯誤 (網路錯誤、OOM、LOADING、BUSY、NOGROUP 等) 可能在伺服器恢復或重建群組後成功，為暫時性錯誤，不停止消費
+func classifyRedisError(err error) *databases.ClassifiedError {
+	classified := &databases.ClassifiedError{Class: databases.ClassTransient, Source: "redis", Err: err}
+
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) || err == redis.Nil {
+		return classified
+	}
+	prefix, _, _ := strings.Cut(redisErr.Error(), " ")
+	switch {
+	case prefix == "NOAUTH", prefix == "WRONGPASS", prefix == "NOPERM":
+		classified.Class = databases.ClassAuth
+	case prefix == "WRONGTYPE", prefix == "ERR" && strings.Contains(redisErr.Error(), "unknown command"):
+		classified.Class = databases.ClassConfig
+	}
+	return classified
+}
+
+// 消費者群組被刪除 (XGROUP DESTROY 或 stream 被刪除) 時回傳 NOGROUP，重建群組後即可繼續消費
+func isNoGroup(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(redisErr.Error(), "NOGROUP")
+}
+
+// * 依錯誤分類決定消費迴圈的反應，回傳 false 時消費者已停止
+// 暫時性錯誤由斷路器和 redis.retry_delay 退避，限流等待 Retry-After，認證和設定錯誤暫停消費並告警
+func (c *consumerControl) react(err error) bool {
+	worst := databases.WorstError(err)
+	if worst == nil {
+		return true
+	}
+
+	switch worst.Class {
+	case databases.ClassAuth, databases.ClassConfig:
+		c.stop(worst)
+		return false
+	case databases.ClassRateLimit:
+		if worst.RetryAfter > 0 {
+			global.Logger.Warn(fmt.Sprintf("Output %s is rate limiting, waiting %v before the next batch", worst.Source, worst.RetryAfter),
+				zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+			consumerHealth.sleep(worst.RetryAfter)
+		}
+	}
+	return true
+}
+
+// 認證或設定錯誤重試也不會成功，暫停消費並觸發告警，修正後以 /admin/streams/{stream}/resume 恢復
+func (c *consumerControl) stop(err *databases.ClassifiedError) {
+	c.mu.Lock()
+	stream := c.state.Stream
+	c.state.StoppedBy = err.Class.String()
+	c.mu.Unlock()
+	c.fail(err)
+	c.setPaused(true)
+	consumerHealth.fail(err)
+
+	message := fmt.Sprintf("Consumer for stream %s stopped after %s error from %s: %v", stream, err.Class, err.Source, err.Err)
+	global.Logger.Error(message,
+		zap.Any(global.LogEvent.ConsumerStopped.Name, global.LogEvent.ConsumerStopped))
+	alerts.Set(global.LogEvent.ConsumerStopped, true, 1, message)
+}
+
+// 恢復消費時解除 stop 觸發的告警
+func (c *consumerControl) resumeStopped() {
+	c.mu.Lock()
+	stopped := c.state.StoppedBy != ""
+	c.state.StoppedBy = ""
+	stream := c.state.Stream
+	c.mu.Unlock()
+
+	if stopped {
+		alerts.Set(global.LogEvent.ConsumerStopped, false, 0, fmt.Sprintf("Consumer for stream %s resumed", stream))
+	}
+}
+
+// * 將被輸出端判定為資料錯誤的消息移到 dead-letter stream，回傳成功移入的消息 ID，之後與成功寫入的消息一起確認並刪除
+// 消息在其他 chunk 中有非資料錯誤的失敗時不隔離，保留在 PEL 中重試
+func quarantine(ctx context.Context, rdb *redis.Client, logger *zap.Logger, messages []redis.XMessage, err error) []string {
+	classes := make(map[string]databases.ErrorClass)
+	reasons := make(map[string]*databases.ClassifiedError)
+	for _, failure := range databases.ClassifiedErrors(err) {
+		for _, id := range failure.IDs {
+			class, ok := classes[id]
+			if !ok {
+				classes[id] = failure.Class
+				reasons[id] = failure
+				continue
+			}
+			classes[id] = databases.WorseClass(class, failure.Class)
+		}
+	}
+
+	stream := deadLetterStream()
+	pipe := rdb.Pipeline()
+	var ids []string
+	for _, message := range messages {
+		if class, ok := classes[message.ID]; !ok || class != databases.ClassBadData {
+			continue
+		}
+		reason := reasons[message.ID]
+		values := make(map[string]interface{}, len(message.Values)+5)
+		for key, value := range message.Values {
+			values[key] = value
+		}
+		values["source_stream"] = global.Config().Redis.StreamKey
+		values["source_id"] = message.ID
+		values["output"] = reason.Source
+		values["status"] = reason.Status
+		values["error"] = reason.Err.Error()
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: values})
+		ids = append(ids, message.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, execErr := pipe.Exec(ctx); execErr != nil {
+		logger.Error(fmt.Sprintf("Failed to move %d bad data messages to dead-letter stream %s, keeping them pending: %v", len(ids), stream, execErr),
+			zap.Any(global.LogEvent.QuarantineData.Name, global.LogEvent.QuarantineData))
+		metrics.RedisErrors.WithLabelValues(global.LogEvent.QuarantineData.Code).Inc()
+		return nil
+	}
+
+	logger.Warn(fmt.Sprintf("Moved %d messages rejected as bad data to dead-letter stream %s", len(ids), stream),
+		zap.Any(global.LogEvent.QuarantineData.Name, global.LogEvent.QuarantineData))
+	metrics.MessagesQuarantined.WithLabelValues(global.Config().Redis.StreamKey).Add(float64(len(ids)))
+	return ids
+}
+
+// 未設定 redis.dead_letter_stream 時為 <stream_key>:dead
+func deadLetterStream() string {
+	if stream := global.Config().Redis.DeadLetterStream; stream != "" {
+		return stream
+	}
+	return global.Config().Redis.StreamKey + ":dead"
+}
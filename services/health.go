@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-redis2influx/databases"
+	"go-redis2influx/global"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthState 記錄消費迴圈的心跳和最後一次錯誤
+type healthState struct {
+	mu          sync.Mutex
+	heartbeat   time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+var consumerHealth = &healthState{}
+
+// dependencyErrors 記錄每個依賴最後一次檢查失敗的錯誤，恢復後仍保留供排查
+var dependencyErrors = struct {
+	sync.Mutex
+	errors map[string]string
+}{errors: make(map[string]string)}
+
+// CheckResult 單一依賴的檢查結果
+type CheckResult struct {
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// HealthResponse /healthz 和 /readyz 的回應內容
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func (h *healthState) beat() {
+	h.mu.Lock()
+	h.heartbeat = time.Now()
+	h.mu.Unlock()
+}
+
+func (h *healthState) fail(err error) {
+	h.mu.Lock()
+	h.lastError = err.Error()
+	h.lastErrorAt = time.Now()
+	h.mu.Unlock()
+}
+
+// sleep 等待期間持續更新心跳，避免長時間退避被誤判為迴圈停止
+func (h *healthState) sleep(d time.Duration) {
+	deadline := time.Now().Add(d)
+	for {
+		h.beat()
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+		if remaining > time.Second {
+			remaining = time.Second
+		}
+		time.Sleep(remaining)
+	}
+}
+
+func (h *healthState) snapshot() (time.Time, string, time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.heartbeat, h.lastError, h.lastErrorAt
+}
+
+// * /healthz：消費迴圈仍在運作 (心跳未逾時)
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	resp := HealthResponse{Status: "ok", Checks: map[string]CheckResult{}}
+	resp.Checks["consumer"] = checkConsumer()
+	writeHealthResponse(w, resp)
+}
+
+// * /readyz：Redis 可連線、消費者群組存在、必要輸出端可寫入
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	config := global.Config()
+	timeout := time.Duration(config.Health.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	resp := HealthResponse{Status: "ok", Checks: map[string]CheckResult{}}
+	resp.Checks["consumer"] = checkConsumer()
+
+	rdb := newRedisClient()
+	defer rdb.Close()
+
+	resp.Checks["redis"] = dependencyResult("redis", rdb.Ping(ctx).Err(), config.Redis.Address)
+
+	groups, err := rdb.XInfoGroups(ctx, config.Redis.StreamKey).Result()
+	if err == nil {
+		err = fmt.Errorf("consumer group %s not found on %s", config.Redis.GroupName, config.Redis.StreamKey)
+		for _, group := range groups {
+			if group.Name == config.Redis.GroupName {
+				err = nil
+				break
+			}
+		}
+	}
+	resp.Checks["consumer_group"] = dependencyResult("consumer_group", err, config.Redis.GroupName)
+
+	// 斷路器狀態只反映最後一次寫入，閒置時也要實際探測輸出端，與 Redis 使用相同的逾時
+	probeCtx, probeCancel := context.WithTimeout(r.Context(), timeout)
+	defer probeCancel()
+	probes := databases.ProbeOutputs(probeCtx)
+
+	for _, output := range databases.OutputStatuses() {
+		result := CheckResult{Status: "ok", Detail: output.State}
+		if !output.Required {
+			result.Detail += " (best-effort)"
+		}
+		result.LastError = output.LastError
+		if err, probed := probes[output.Name]; probed && err != nil {
+			output.Available = false
+			result.LastError = err.Error()
+		}
+		if !output.Available {
+			result.Status = "fail"
+			if !output.Required {
+				result.Status = "degraded"
+			}
+		}
+		resp.Checks["output:"+output.Name] = result
+	}
+
+	writeHealthResponse(w, resp)
+}
+
+func checkConsumer() CheckResult {
+	maxAge := time.Duration(global.Config().Health.MaxHeartbeatAge) * time.Second
+	if maxAge <= 0 {
+		maxAge = 60 * time.Second
+	}
+
+	heartbeat, lastError, lastErrorAt := consumerHealth.snapshot()
+	result := CheckResult{Status: "ok"}
+	if lastError != "" {
+		result.LastError = fmt.Sprintf("%s: %s", lastErrorAt.Format(time.RFC3339), lastError)
+	}
+
+	if heartbeat.IsZero() {
+		result.Status = "fail"
+		result.Detail = "consumer loop has not started"
+		return result
+	}
+
+	age := time.Since(heartbeat)
+	result.Detail = fmt.Sprintf("heartbeat age %v (max %v)", age.Round(time.Millisecond), maxAge)
+	if age > maxAge {
+		result.Status = "fail"
+	}
+	return result
+}
+
+func dependencyResult(name string, err error, detail string) CheckResult {
+	dependencyErrors.Lock()
+	defer dependencyErrors.Unlock()
+
+	result := CheckResult{Status: "ok", Detail: detail}
+	if err != nil {
+		result.Status = "fail"
+		dependencyErrors.errors[name] = fmt.Sprintf("%s: %v", time.Now().Format(time.RFC3339), err)
+	}
+	result.LastError = dependencyErrors.errors[name]
+	return result
+}
+
+// 任何檢查為 fail 時回傳 503，degraded 不影響狀態碼
+func writeHealthResponse(w http.ResponseWriter, resp HealthResponse) {
+	for _, check := range resp.Checks {
+		if check.Status == "fail" {
+			resp.Status = "fail"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// * 啟動可選的 HTTP 監聽 (/metrics、/healthz、/readyz、/admin)，http.address 未設定時不啟動
+func StartHTTPServer() {
+	address := global.Config().HTTP.Address
+	if address == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", HealthzHandler)
+	mux.HandleFunc("/readyz", ReadyzHandler)
+	registerAdminHandlers(mux)
+
+	go func() {
+		global.Logger.Info(fmt.Sprintf("HTTP server listening on %s", address),
+			zap.Any(global.LogEvent.HTTPServer.Name, global.LogEvent.HTTPServer))
+		if err := http.ListenAndServe(address, mux); err != nil {
+			global.Logger.Error(fmt.Sprintf("HTTP server stopped: %v", err),
+				zap.Any(global.LogEvent.HTTPServer.Name, global.LogEvent.HTTPServer))
+		}
+	}()
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// StreamBacklog 單一 stream 和消費者群組的積壓狀態
+type StreamBacklog struct {
+	Stream            string
+	Group             string
+	Length            int64
+	EntriesRead       int64 // Redis 7 以前為 -1
+	Lag               int64 // Redis 7 以前或無法計算時為 -1
+	Pending           int64
+	PendingByConsumer map[string]int64
+	OldestPendingAge  time.Duration
+	CheckedAt         time.Time
+}
+
+// 最近一次監控結果，供自我遙測使用
+var backlogs = struct {
+	sync.RWMutex
+	streams map[string]*StreamBacklog
+}{streams: make(map[string]*StreamBacklog)}
+
+// 設定中的所有 stream
+func streamKeys() []string {
+	return []string{global.Config().Redis.StreamKey}
+}
+
+// * 啟動積壓監控，定期查詢 XINFO STREAM、XINFO GROUPS 和 XPENDING
+func StartMonitor() {
+	cfg := global.Config().Monitor
+	if cfg.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		rdb := newRedisClient()
+		for {
+			for _, stream := range streamKeys() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				backlog, err := inspectStream(ctx, rdb, stream)
+				cancel()
+				if err != nil {
+					global.Logger.Warn(fmt.Sprintf("Failed to inspect stream %s: %v", stream, err),
+						zap.Any(global.LogEvent.StreamMonitor.Name, global.LogEvent.StreamMonitor))
+					metrics.RedisErrors.WithLabelValues(global.LogEvent.StreamMonitor.Code).Inc()
+					continue
+				}
+
+				backlogs.Lock()
+				backlogs.streams[stream] = backlog
+				backlogs.Unlock()
+
+				exportBacklog(backlog)
+				checkBacklog(backlog)
+			}
+			time.Sleep(time.Duration(global.Config().Monitor.Interval) * time.Second)
+		}
+	}()
+}
+
+// * 查詢一次所有 stream 的積壓狀態並輸出到 w (inspect 指令)
+func Inspect(w io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rdb := newRedisClient()
+	defer rdb.Close()
+
+	for _, stream := range streamKeys() {
+		b, err := inspectStream(ctx, rdb, stream)
+		if err != nil {
+			return fmt.Errorf("inspect %s: %w", stream, err)
+		}
+
+		fmt.Fprintf(w, "stream:             %s\n", b.Stream)
+		fmt.Fprintf(w, "group:              %s\n", b.Group)
+		fmt.Fprintf(w, "length:             %d\n", b.Length)
+		fmt.Fprintf(w, "entries read:       %d\n", b.EntriesRead)
+		fmt.Fprintf(w, "lag:                %d\n", b.Lag)
+		fmt.Fprintf(w, "pending:            %d\n", b.Pending)
+		fmt.Fprintf(w, "oldest pending age: %v\n", b.OldestPendingAge.Round(time.Second))
+
+		consumers := make([]string, 0, len(b.PendingByConsumer))
+		for consumer := range b.PendingByConsumer {
+			consumers = append(consumers, consumer)
+		}
+		sort.Strings(consumers)
+		for _, consumer := range consumers {
+			fmt.Fprintf(w, "  %-18s %d pending\n", consumer, b.PendingByConsumer[consumer])
+		}
+	}
+	return nil
+}
+
+// 取得最近一次監控結果，監控未啟用或尚未執行時直接查詢
+func latestBacklog(ctx context.Context, rdb *redis.Client, stream string) (*StreamBacklog, error) {
+	backlogs.RLock()
+	backlog, ok := backlogs.streams[stream]
+	backlogs.RUnlock()
+	if ok {
+		return backlog, nil
+	}
+	return inspectStream(ctx, rdb, stream)
+}
+
+// * 查詢 stream 長度、群組 lag 和 PEL 摘要，最舊待處理消息的時間由 stream ID 的毫秒時間戳推算
+func inspectStream(ctx context.Context, rdb *redis.Client, stream string) (*StreamBacklog, error) {
+	group := global.Config().Redis.GroupName
+	backlog := &StreamBacklog{
+		Stream:            stream,
+		Group:             group,
+		EntriesRead:       -1,
+		Lag:               -1,
+		PendingByConsumer: make(map[string]int64),
+		CheckedAt:         time.Now(),
+	}
+
+	info, err := rdb.XInfoStream(ctx, stream).Result()
+	if err != nil {
+		return nil, err
+	}
+	backlog.Length = info.Length
+
+	groups, err := xinfoGroups(ctx, rdb, stream)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g["name"] != group {
+			continue
+		}
+		if value, ok := g["entries-read"].(int64); ok {
+			backlog.EntriesRead = value
+		}
+		if value, ok := g["lag"].(int64); ok {
+			backlog.Lag = value
+		}
+	}
+
+	pending, err := rdb.XPending(ctx, stream, group).Result()
+	if err != nil {
+		return nil, err
+	}
+	backlog.Pending = pending.Count
+	for consumer, count := range pending.Consumers {
+		backlog.PendingByConsumer[consumer] = count
+	}
+	if pending.Count > 0 {
+		if ms, err := strconv.ParseInt(strings.SplitN(pending.Lower, "-", 2)[0], 10, 64); err == nil {
+			backlog.OldestPendingAge = backlog.CheckedAt.Sub(time.UnixMilli(ms))
+		}
+	}
+	return backlog, nil
+}
+
+func exportBacklog(b *StreamBacklog) {
+	metrics.StreamLength.WithLabelValues(b.Stream).Set(float64(b.Length))
+	metrics.GroupLag.WithLabelValues(b.Stream, b.Group).Set(float64(b.Lag))
+	metrics.OldestPendingAge.WithLabelValues(b.Stream, b.Group).Set(b.OldestPendingAge.Seconds())
+	metrics.PendingMessages.DeletePartialMatch(map[string]string{"stream": b.Stream, "group": b.Group})
+	for consumer, count := range b.PendingByConsumer {
+		metrics.PendingMessages.WithLabelValues(b.Stream, b.Group, consumer).Set(float64(count))
+	}
+}
+
+// 依設定的門檻記錄 warn 或 error，門檻為 0 時不檢查
+func checkBacklog(b *StreamBacklog) {
+	cfg := global.Config().Monitor
+	event := zap.Any(global.LogEvent.StreamMonitor.Name, global.LogEvent.StreamMonitor)
+
+	var problems []string
+	level := 0
+	check := func(name string, value, warn, errorThreshold int64) {
+		switch {
+		case errorThreshold > 0 && value >= errorThreshold:
+			problems = append(problems, fmt.Sprintf("%s %d >= %d", name, value, errorThreshold))
+			level = 2
+		case warn > 0 && value >= warn:
+			problems = append(problems, fmt.Sprintf("%s %d >= %d", name, value, warn))
+			if level < 1 {
+				level = 1
+			}
+		}
+	}
+	check("lag", b.Lag, cfg.LagWarn, cfg.LagError)
+	check("pending", b.Pending, cfg.PendingWarn, cfg.PendingError)
+	check("oldest pending age (s)", int64(b.OldestPendingAge.Seconds()), cfg.OldestPendingWarn, cfg.OldestPendingError)
+
+	msg := fmt.Sprintf("Stream %s group %s: length %d, lag %d, pending %d %v, oldest pending %v",
+		b.Stream, b.Group, b.Length, b.Lag, b.Pending, b.PendingByConsumer, b.OldestPendingAge.Round(time.Second))
+	switch level {
+	case 2:
+		global.Logger.Error(fmt.Sprintf("%s (%s)", msg, strings.Join(problems, ", ")), event)
+	case 1:
+		global.Logger.Warn(fmt.Sprintf("%s (%s)", msg, strings.Join(problems, ", ")), event)
+	default:
+		global.Logger.Debug(msg, event)
+	}
+}
+
+// go-redis v8 的 XInfoGroups 沒有 Redis 7 新增的 entries-read 和 lag，改用原始指令解析
+func xinfoGroups(ctx context.Context, rdb *redis.Client, stream string) ([]map[string]interface{}, error) {
+	reply, err := rdb.Do(ctx, "XINFO", "GROUPS", stream).Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]map[string]interface{}, 0, len(reply))
+	for _, item := range reply {
+		values, ok := item.([]interface{})
+		if !ok {
+			continue
+		}
+		group := make(map[string]interface{}, len(values)/2)
+		for i := 0; i+1 < len(values); i += 2 {
+			if key, ok := values[i].(string); ok {
+				group[key] = values[i+1]
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
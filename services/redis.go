@@ -1,8 +1,11 @@
 package services
 
 import (
+	"errors"
 	"go-redis2influx/databases"
 	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"go-redis2influx/models"
 	"context"
 	"fmt"
 	"strings"
@@ -12,169 +15,405 @@ import (
 	"go.uber.org/zap"
 )
 
-func ReadRedisData() {
-
-	config := global.EnvConfig.Redis
-
-	// 初始化 Redis 客戶端
-	ctx := context.Background()
-	rdb := redis.NewClient(&redis.Options{
-		Addr: config.Address,
-		DB:   config.DB,
+func newRedisClient() *redis.Client {
+	config := global.Config().Redis
+	return redis.NewClient(&redis.Options{
+		Addr:     config.Address,
+		Password: config.Password,
+		DB:       config.DB,
 	})
+}
+
+// 創建消費者群組（如果不存在）
+func createGroup(ctx context.Context, rdb *redis.Client) error {
+	config := global.Config().Redis
 
-	// 創建消費者群組（如果不存在）
 	err := rdb.XGroupCreateMkStream(ctx, config.StreamKey, config.GroupName, "0").Err()
 	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP Consumer Group name already exists") {
 		global.Logger.Error(fmt.Sprintf("Failed to create consumer group: %v", err),
 			zap.Any(global.LogEvent.RedisGroupCreate.Name, global.LogEvent.RedisGroupCreate))
-		return
+		metrics.RedisErrors.WithLabelValues(global.LogEvent.RedisGroupCreate.Code).Inc()
+		return err
 	}
+	return nil
+}
+
+func ReadRedisData() {
+
+	config := global.Config().Redis
+
+	// 初始化 Redis 客戶端
+	ctx := context.Background()
+	rdb := newRedisClient()
 
-	// 設置阻塞時間和讀取數量
-	blockDuration := time.Duration(config.BlockMs) * time.Millisecond
+	control := consumerFor(config.StreamKey)
+
+	// Redis 啟動時暫時無法連線也要持續重試，只有認證或設定錯誤才停止，恢復後再重試
+	for {
+		err := createGroup(ctx, rdb)
+		if err == nil {
+			break
+		}
+		consumerHealth.fail(err)
+		if !control.react(classifyRedisError(err)) {
+			control.serve(ctx, rdb)
+			continue
+		}
+		consumerHealth.sleep(time.Duration(global.Config().Redis.RetryDelay) * time.Second)
+	}
 
 	for {
-		// 檢查 InfluxDB 連線狀態
+		consumerHealth.beat()
+
+		// 設置阻塞時間和讀取數量，每次迭代重新讀取以套用重新載入的設定
+		count := global.Config().Redis.Count
+		blockDuration := time.Duration(global.Config().Redis.BlockMs) * time.Millisecond
+
+		// 在兩次迭代之間處理管理端點的暫停和清空請求，不影響進行中的批次
+		control.serve(ctx, rdb)
+
+		// 檢查 InfluxDB 斷路器狀態，只有斷路器開啟時才會探測連線
 		for !databases.InfluxdbConnectionAvailable() {
 			global.Logger.Warn("InfluxDB is unavailable, retrying...",
 				zap.Any(global.LogEvent.ConnectInfluxDB.Name, global.LogEvent.ConnectInfluxDB))
-			// 從環境參數中獲取重試延遲
-			time.Sleep(time.Duration(global.EnvConfig.Redis.RetryDelay) * time.Second)
+			// 依斷路器的退避時間等待下一次探測
+			consumerHealth.sleep(databases.RetryDelay())
 		}
 
-		// 讀取 Stream 中的消息（使用配置中的 Count 和 Block 參數）
-		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
-			Group:    config.GroupName,
-			Consumer: config.ConsumerName,
-			Streams:  []string{config.StreamKey, ">"},
-			Count:    int64(config.Count), // 每次讀取數據的數量，取決於配置
-			Block:    blockDuration,
-		}).Result()
+		// 讀取 Stream 中的消息（使用配置中的 Count 和 Block 參數），先重試 PEL 中寫入失敗的消息
+		streams, err := readBatch(ctx, rdb, count, blockDuration)
 
 		if err != nil && err != redis.Nil {
-			global.Logger.Error(fmt.Sprintf("Error reading from Redis stream: %v", err),
+			classified := classifyRedisError(err)
+			global.Logger.Error(fmt.Sprintf("Error reading from Redis stream (%s): %v", classified.Class, err),
 				zap.Any(global.LogEvent.ReadRedisStream.Name, global.LogEvent.ReadRedisStream))
+			metrics.RedisErrors.WithLabelValues(global.LogEvent.ReadRedisStream.Code).Inc()
+			consumerHealth.fail(err)
+			// 群組不存在時重建，成功後立即重新讀取
+			if isNoGroup(err) {
+				global.Logger.Warn(fmt.Sprintf("Consumer group %s no longer exists on %s, recreating it", config.GroupName, config.StreamKey),
+					zap.Any(global.LogEvent.RedisGroupCreate.Name, global.LogEvent.RedisGroupCreate))
+				if createGroup(ctx, rdb) == nil {
+					continue
+				}
+			}
+			// 認證或設定錯誤時暫停，下一次迭代在 serve 中等待恢復
+			if !control.react(classified) {
+				continue
+			}
 			// 重試前等待設置的重試延遲時間
-			time.Sleep(time.Duration(global.EnvConfig.Redis.RetryDelay) * time.Second)
+			consumerHealth.sleep(time.Duration(global.Config().Redis.RetryDelay) * time.Second)
 			continue
 		}
 
-		var batchData []string  // 存放這次讀取的所有數據
-		var messageIDs []string // 存放所有成功處理的消息ID
-
 		for _, stream := range streams {
-			for _, message := range stream.Messages {
-				data, ok := message.Values[config.MessageField].(string)
-				if !ok {
-					global.Logger.Error(fmt.Sprintf("Failed to parse data from message: %v", message),
-						zap.Any(global.LogEvent.ReadRedisStream.Name, global.LogEvent.ReadRedisStream))
-					continue
-				}
-
-				// 將數據加入到批量數據集中
-				batchData = append(batchData, data)
-				messageIDs = append(messageIDs, message.ID)
+			metrics.MessagesRead.WithLabelValues(stream.Stream).Add(float64(len(stream.Messages)))
+			if _, err := processBatch(ctx, rdb, control, stream.Messages); !control.react(err) {
+				break
 			}
+		}
 
-			// 將數據寫入 InfluxDB 成功後刪除
-			if len(batchData) > 0 {
-				err = databases.WriteLineProtocol(batchData)
-				if err == nil {
-					// 成功寫入後，刪除這些已處理的消息
-					for _, msgID := range messageIDs {
-						rdb.XDel(ctx, config.StreamKey, msgID)
-					}
-				}
-			}
+		// 在迴圈中等待 blockDuration 再進行下一次迴圈
+		consumerHealth.sleep(blockDuration)
+	}
+}
+
+// 寫入失敗的消息保留在此消費者的 PEL 中，每次讀取新消息前先從 ID 0 重讀 PEL，PEL 清空後才以 > 讀取新消息並阻塞等待
+func readBatch(ctx context.Context, rdb *redis.Client, count int, block time.Duration) ([]redis.XStream, error) {
+	config := global.Config().Redis
+	streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    config.GroupName,
+		Consumer: config.ConsumerName,
+		Streams:  []string{config.StreamKey, "0"},
+		Count:    int64(count),
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if len(streams) > 0 && len(streams[0].Messages) > 0 {
+		return streams, nil
+	}
+
+	return rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    config.GroupName,
+		Consumer: config.ConsumerName,
+		Streams:  []string{config.StreamKey, ">"},
+		Count:    int64(count), // 每次讀取數據的數量，取決於配置
+		Block:    block,
+	}).Result()
+}
+
+// * 只讀取並處理一個批次後返回 (--once)，必要輸出端無法使用時直接回傳錯誤而不等待
+func ReadRedisOnce() (int, error) {
+	config := global.Config().Redis
+	ctx := context.Background()
+	rdb := newRedisClient()
+	defer rdb.Close()
+
+	if err := createGroup(ctx, rdb); err != nil {
+		return 0, err
+	}
+	if !databases.InfluxdbConnectionAvailable() {
+		return 0, fmt.Errorf("required outputs are unavailable")
+	}
+
+	streams, err := readBatch(ctx, rdb, config.Count, time.Duration(config.BlockMs)*time.Millisecond)
+	if err != nil && err != redis.Nil {
+		global.Logger.Error(fmt.Sprintf("Error reading from Redis stream: %v", err),
+			zap.Any(global.LogEvent.ReadRedisStream.Name, global.LogEvent.ReadRedisStream))
+		metrics.RedisErrors.WithLabelValues(global.LogEvent.ReadRedisStream.Code).Inc()
+		return 0, err
+	}
+
+	control := consumerFor(config.StreamKey)
+	written := 0
+	for _, stream := range streams {
+		metrics.MessagesRead.WithLabelValues(stream.Stream).Add(float64(len(stream.Messages)))
+		n, err := processBatch(ctx, rdb, control, stream.Messages)
+		written += n
+		if err != nil {
+			return written, err
 		}
+	}
+	return written, nil
+}
 
-		// 將這次批量讀取的所有數據一次性寫入 InfluxDB
-		if len(batchData) > 0 {
-			err = databases.WriteLineProtocol(batchData) // 將所有讀取到的數據一次性寫入
-			if err != nil {
-				global.Logger.Error(fmt.Sprintf("Failed to write batch data to InfluxDB: %v", err),
-					zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
-				// 如果寫入失敗，保留數據，下次重試
-				continue
-			}
+// * 批次關聯 ID 為 stream/第一個消息 ID..最後一個消息 ID#嘗試次數，回傳帶有此 ID 的 child logger
+// 同一批消息重試時只有嘗試次數不同，讀取、解析、寫入、確認和刪除的日誌都使用此 logger
+func batchLogger(stream, firstID, lastID string, attempt int) (string, *zap.Logger) {
+	batch := fmt.Sprintf("%s/%s..%s#%d", stream, firstID, lastID, attempt)
+	return batch, global.Logger.With(
+		zap.String("batch", batch),
+		zap.String("stream", stream),
+		zap.String("first_id", firstID),
+		zap.String("last_id", lastID),
+		zap.Int("attempt", attempt))
+}
 
-			// 批次確認成功寫入的所有消息
-			err = rdb.XAck(ctx, config.StreamKey, config.GroupName, messageIDs...).Err()
-			if err != nil {
-				global.Logger.Error(fmt.Sprintf("Failed to batch acknowledge messages: %v", err),
-					zap.Any(global.LogEvent.AckRedisMessage.Name, global.LogEvent.AckRedisMessage))
-			} else {
-				global.Logger.Info(fmt.Sprintf("Successfully acknowledged %d records from Redis Stream", len(messageIDs)),
-					zap.Any(global.LogEvent.AckRedisMessage.Name, global.LogEvent.AckRedisMessage))
-			}
+// 嘗試次數取自 Redis 記錄的投遞次數，XREADGROUP 每次投遞 (包含從 PEL 重讀) 都會加一，重新啟動後也不會歸零
+// 消息不在此消費者的 PEL 中或查詢失敗時視為第一次嘗試
+func deliveryCount(ctx context.Context, rdb *redis.Client, id string) int {
+	config := global.Config().Redis
+	pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   config.StreamKey,
+		Group:    config.GroupName,
+		Start:    id,
+		End:      id,
+		Count:    1,
+		Consumer: config.ConsumerName,
+	}).Result()
+	if err != nil || len(pending) == 0 || pending[0].RetryCount <= 0 {
+		return 1
+	}
+	return int(pending[0].RetryCount)
+}
+
+// 解析消息中的 line protocol，缺少 message_field 的消息略過並回傳其 ID，由呼叫端隔離或計入 lines_rejected_total
+func parseMessages(logger *zap.Logger, messages []redis.XMessage) ([]models.Message, []string) {
+	config := global.Config().Redis
+	var batchData []models.Message // 存放這次讀取的所有數據
+	var missing []string
 
-			global.Logger.Info(fmt.Sprintf("Successfully written %d records to InfluxDB", len(batchData)),
+	for _, message := range messages {
+		data, ok := message.Values[config.MessageField].(string)
+		if !ok {
+			logger.Error(fmt.Sprintf("Failed to parse data from message: %v", message),
+				zap.Any(global.LogEvent.ReadRedisStream.Name, global.LogEvent.ReadRedisStream))
+			missing = append(missing, message.ID)
+			continue
+		}
+
+		// 將數據加入到批量數據集中
+		batchData = append(batchData, models.Message{ID: message.ID, Data: data})
+	}
+	return batchData, missing
+}
+
+// * 將一批消息寫入所有輸出端，成功後確認並刪除，回傳成功寫入的消息數量
+// 輸出端判定為資料錯誤的消息移到 dead-letter stream 後一起確認並刪除，其他錯誤以 *databases.ClassifiedError 回傳
+func processBatch(ctx context.Context, rdb *redis.Client, control *consumerControl, messages []redis.XMessage) (int, error) {
+	config := global.Config().Redis
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	firstID, lastID := messages[0].ID, messages[len(messages)-1].ID
+	attempt := deliveryCount(ctx, rdb, firstID)
+	batch, logger := batchLogger(config.StreamKey, firstID, lastID, attempt)
+	logger.Debug(fmt.Sprintf("Read %d messages from Redis Stream", len(messages)),
+		zap.Any(global.LogEvent.ReadRedisStream.Name, global.LogEvent.ReadRedisStream))
+
+	batchData, missing := parseMessages(logger, messages)
+
+	var messageIDs []string
+	var err error
+	written := 0
+	if len(batchData) > 0 {
+		// 將這次批量讀取的所有數據切分後寫入所有輸出端，消息所在的 chunk 全部成功才確認
+		control.begin(batch, attempt, batchData)
+		defer control.end()
+
+		metrics.BatchSize.Observe(float64(len(batchData)))
+		messageIDs, err = databases.WriteLineProtocol(logger, batchData)
+		written = len(messageIDs)
+		metrics.MessagesWritten.WithLabelValues(config.StreamKey).Add(float64(written))
+		if err != nil {
+			// 寫入失敗的消息保留在 PEL 中，下次重試
+			logger.Error(fmt.Sprintf("Failed to write %d of %d messages to InfluxDB (%s): %v", len(batchData)-written, len(batchData), databases.WorstError(err).Class, err),
 				zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+			consumerHealth.fail(err)
+			control.fail(err)
 		}
+	}
 
-		// 在迴圈中等待 blockDuration 再進行下一次迴圈
-		time.Sleep(blockDuration)
+	// 資料錯誤和缺少 message_field 的消息重試也不會成功，移到 dead-letter stream 後與成功寫入的消息一起確認並刪除
+	// 否則會一直留在 PEL 中，每次重讀 PEL 都讀到它們而無法讀取新消息
+	rejected := err
+	if len(missing) > 0 {
+		rejected = errors.Join(err, &databases.ClassifiedError{Class: databases.ClassBadData, Source: "redis", IDs: missing,
+			Err: fmt.Errorf("message has no %s field", config.MessageField)})
 	}
+	if rejected != nil {
+		quarantined := quarantine(ctx, rdb, logger, messages, rejected)
+		messageIDs = append(messageIDs, quarantined...)
+		if len(messageIDs) == len(messages) {
+			err = nil
+		}
+	}
+	if len(messageIDs) == 0 {
+		return 0, err
+	}
+	// 批次確認成功寫入的所有消息
+	control.stage("acking")
+	ackErr := rdb.XAck(ctx, config.StreamKey, config.GroupName, messageIDs...).Err()
+	if ackErr != nil {
+		logger.Error(fmt.Sprintf("Failed to batch acknowledge messages: %v", ackErr),
+			zap.Any(global.LogEvent.AckRedisMessage.Name, global.LogEvent.AckRedisMessage))
+		metrics.RedisErrors.WithLabelValues(global.LogEvent.AckRedisMessage.Code).Inc()
+		control.fail(ackErr)
+	} else {
+		logger.Info(fmt.Sprintf("Successfully acknowledged %d records from Redis Stream", len(messageIDs)),
+			zap.Any(global.LogEvent.AckRedisMessage.Name, global.LogEvent.AckRedisMessage))
+		metrics.MessagesAcked.WithLabelValues(config.StreamKey).Add(float64(len(messageIDs)))
+
+		// 確認後刪除這些已處理的消息
+		control.stage("deleting")
+		if delErr := rdb.XDel(ctx, config.StreamKey, messageIDs...).Err(); delErr != nil {
+			logger.Error(fmt.Sprintf("Failed to batch delete messages: %v", delErr),
+				zap.Any(global.LogEvent.AckRedisMessage.Name, global.LogEvent.AckRedisMessage))
+			metrics.RedisErrors.WithLabelValues(global.LogEvent.AckRedisMessage.Code).Inc()
+		} else {
+			metrics.MessagesDeleted.WithLabelValues(config.StreamKey).Add(float64(len(messageIDs)))
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Successfully written %d records to InfluxDB", written),
+		zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+
+	if err == nil {
+		err = ackErr
+	}
+	return written, err
 }
 
-func ProcessRemainingDataFromRedis() {
-	config := global.EnvConfig.Redis
+// * 清空此消費者的 PEL：以 XREADGROUP 從 ID 0 開始逐批讀取已投遞但未確認的消息並重新寫入
+func drainPending(ctx context.Context, rdb *redis.Client, control *consumerControl) (int, error) {
+	config := global.Config().Redis
+	cursor := "0"
+	drained := 0
+
+	for {
+		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    config.GroupName,
+			Consumer: config.ConsumerName,
+			Streams:  []string{config.StreamKey, cursor},
+			Count:    int64(config.Count),
+		}).Result()
+		if err != nil && err != redis.Nil {
+			metrics.RedisErrors.WithLabelValues(global.LogEvent.ReadRedisStream.Code).Inc()
+			return drained, err
+		}
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			return drained, nil
+		}
+
+		messages := streams[0].Messages
+		metrics.MessagesRead.WithLabelValues(config.StreamKey).Add(float64(len(messages)))
+		n, err := processBatch(ctx, rdb, control, messages)
+		drained += n
+		if err != nil {
+			return drained, err
+		}
+		cursor = messages[len(messages)-1].ID
+	}
+}
+
+// * 讀取 stream 中所有剩餘的消息重新寫入，成功後刪除，不經過消費者群組
+func ProcessRemainingDataFromRedis() error {
+	config := global.Config().Redis
 	ctx := context.Background()
-	rdb := redis.NewClient(&redis.Options{
-		Addr: config.Address,
-		DB:   config.DB,
-	})
+	rdb := newRedisClient()
 
 	// 讀取 Redis 中所有未處理的數據
 	streams, err := rdb.XRange(ctx, config.StreamKey, "-", "+").Result()
 	if err != nil {
 		global.Logger.Error(fmt.Sprintf("Failed to read from Redis stream: %v", err),
 			zap.Any(global.LogEvent.ReadRedisStream.Name, global.LogEvent.ReadRedisStream))
-		return
+		metrics.RedisErrors.WithLabelValues(global.LogEvent.ReadRedisStream.Code).Inc()
+		return err
 	}
+	metrics.MessagesRead.WithLabelValues(config.StreamKey).Add(float64(len(streams)))
 
-	var messageIDs []string
-	var batchData []string
-
-	for _, message := range streams {
-		data, ok := message.Values[config.MessageField].(string)
-		if !ok {
-			global.Logger.Error(fmt.Sprintf("Failed to parse data from message: %v", message),
-				zap.Any(global.LogEvent.ReadRedisStream.Name, global.LogEvent.ReadRedisStream))
-			continue
-		}
-
-		// 收集數據重新寫入 InfluxDB
-		batchData = append(batchData, data)
-		messageIDs = append(messageIDs, message.ID)
+	if len(streams) == 0 {
+		global.Logger.Info("No residual data found in Redis to process.",
+			zap.Any(global.LogEvent.ReadRedisStream.Name, global.LogEvent.ReadRedisStream))
+		return nil
 	}
 
+	// 不經過消費者群組，沒有先前嘗試的紀錄
+	_, logger := batchLogger(config.StreamKey, streams[0].ID, streams[len(streams)-1].ID, 1)
+	logger.Debug(fmt.Sprintf("Read %d residual messages from Redis Stream", len(streams)),
+		zap.Any(global.LogEvent.ReadRedisStream.Name, global.LogEvent.ReadRedisStream))
+	batchData, missing := parseMessages(logger, streams)
+	metrics.LinesRejected.WithLabelValues("missing_field").Add(float64(len(missing)))
+
 	// 批量重新寫入 InfluxDB
 	if len(batchData) > 0 {
-		err = databases.WriteLineProtocol(batchData)
-		if err == nil {
+		metrics.BatchSize.Observe(float64(len(batchData)))
+		messageIDs, writeErr := databases.WriteLineProtocol(logger, batchData)
+		written := len(messageIDs)
+		metrics.MessagesWritten.WithLabelValues(config.StreamKey).Add(float64(written))
+		if writeErr != nil {
+			logger.Error(fmt.Sprintf("Failed to re-write %d of %d messages to InfluxDB (%s): %v", len(batchData)-written, len(batchData), databases.WorstError(writeErr).Class, writeErr),
+				zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
+
+			// 資料錯誤的消息移到 dead-letter stream 後一起刪除
+			quarantined := quarantine(ctx, rdb, logger, streams, writeErr)
+			messageIDs = append(messageIDs, quarantined...)
+			if written+len(quarantined) == len(batchData) {
+				writeErr = nil
+			}
+		}
+
+		if len(messageIDs) > 0 {
 			// 記錄成功寫入的筆數
-			global.Logger.Info(fmt.Sprintf("Successfully re-written %d records to InfluxDB", len(batchData)),
+			logger.Info(fmt.Sprintf("Successfully re-written %d records to InfluxDB", written),
 				zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
 
 			// 批量刪除 Redis 中的這些消息
-			if len(messageIDs) > 0 {
-				err = rdb.XDel(ctx, config.StreamKey, messageIDs...).Err()
-				if err != nil {
-					global.Logger.Error(fmt.Sprintf("Failed to batch delete messages: %v", err),
-						zap.Any(global.LogEvent.AckRedisMessage.Name, global.LogEvent.AckRedisMessage))
-				} else {
-					global.Logger.Info(fmt.Sprintf("Successfully deleted %d records from Redis Stream", len(messageIDs)),
-						zap.Any(global.LogEvent.AckRedisMessage.Name, global.LogEvent.AckRedisMessage))
-				}
+			err = rdb.XDel(ctx, config.StreamKey, messageIDs...).Err()
+			if err != nil {
+				logger.Error(fmt.Sprintf("Failed to batch delete messages: %v", err),
+					zap.Any(global.LogEvent.AckRedisMessage.Name, global.LogEvent.AckRedisMessage))
+				metrics.RedisErrors.WithLabelValues(global.LogEvent.AckRedisMessage.Code).Inc()
+				return err
+			} else {
+				logger.Info(fmt.Sprintf("Successfully deleted %d records from Redis Stream", len(messageIDs)),
+					zap.Any(global.LogEvent.AckRedisMessage.Name, global.LogEvent.AckRedisMessage))
+				metrics.MessagesDeleted.WithLabelValues(config.StreamKey).Add(float64(len(messageIDs)))
 			}
-		} else {
-			global.Logger.Error(fmt.Sprintf("Failed to re-write data to InfluxDB: %v", err),
-				zap.Any(global.LogEvent.OutputInfluxDB.Name, global.LogEvent.OutputInfluxDB))
 		}
-	} else {
-		global.Logger.Info("No residual data found in Redis to process.",
-			zap.Any(global.LogEvent.ReadRedisStream.Name, global.LogEvent.ReadRedisStream))
+		return writeErr
 	}
+	return nil
 }
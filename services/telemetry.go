@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-redis2influx/databases"
+	"go-redis2influx/global"
+	"go-redis2influx/metrics"
+	"os"
+	"runtime"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"go.uber.org/zap"
+)
+
+const telemetryMeasurement = "redis2influx_stats"
+
+// * 啟動自我遙測，每隔 interval 秒寫入 redis2influx_stats 到設定的 bucket
+// InfluxDB 無法使用時略過該次回報，下一次回報涵蓋略過的區間
+func StartTelemetry() {
+	cfg := global.Config().Telemetry
+	if cfg.Interval <= 0 || cfg.Bucket == "" {
+		return
+	}
+
+	instance := cfg.Instance
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	stream := global.Config().Redis.StreamKey
+
+	go func() {
+		rdb := newRedisClient()
+		prev, prevTime := metrics.Snapshot(stream), time.Now()
+
+		for range time.Tick(time.Duration(cfg.Interval) * time.Second) {
+			now := time.Now()
+			current := metrics.Snapshot(stream)
+			elapsed := now.Sub(prevTime).Seconds()
+
+			fields := map[string]interface{}{
+				"messages_read":    int64(current.Read - prev.Read),
+				"messages_written": int64(current.Written - prev.Written),
+				"messages_acked":   int64(current.Acked - prev.Acked),
+				"throughput":       (current.Written - prev.Written) / elapsed,
+				"errors":           int64(current.RedisErrors - prev.RedisErrors + current.WriteErrors - prev.WriteErrors),
+				"rejected":         int64(current.Rejected - prev.Rejected),
+			}
+			if count := current.WriteCount - prev.WriteCount; count > 0 {
+				fields["batch_latency_ms"] = (current.WriteSeconds - prev.WriteSeconds) / count * 1000
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			backlog, err := latestBacklog(ctx, rdb, stream)
+			cancel()
+			if err != nil {
+				global.Logger.Debug(fmt.Sprintf("Telemetry failed to query stream backlog: %v", err),
+					zap.Any(global.LogEvent.SelfTelemetry.Name, global.LogEvent.SelfTelemetry))
+			} else {
+				fields["pel_size"] = backlog.Pending
+				fields["stream_length"] = backlog.Length
+				fields["oldest_pending_age"] = backlog.OldestPendingAge.Seconds()
+				if backlog.Lag >= 0 {
+					fields["lag"] = backlog.Lag
+				}
+			}
+
+			var mem runtime.MemStats
+			runtime.ReadMemStats(&mem)
+			fields["mem_heap_alloc"] = int64(mem.HeapAlloc)
+			fields["mem_sys"] = int64(mem.Sys)
+			fields["goroutines"] = int64(runtime.NumGoroutine())
+
+			point := influxdb2.NewPoint(telemetryMeasurement,
+				map[string]string{"instance": instance, "stream": stream}, fields, now)
+
+			err = databases.WriteTelemetry(cfg.Bucket, point)
+			if errors.Is(err, databases.ErrCircuitOpen) {
+				global.Logger.Debug("InfluxDB is unavailable, skipped telemetry report",
+					zap.Any(global.LogEvent.SelfTelemetry.Name, global.LogEvent.SelfTelemetry))
+				continue
+			}
+			if err != nil {
+				global.Logger.Warn(fmt.Sprintf("Failed to write telemetry to bucket %s: %v", cfg.Bucket, err),
+					zap.Any(global.LogEvent.SelfTelemetry.Name, global.LogEvent.SelfTelemetry))
+				continue
+			}
+			prev, prevTime = current, now
+		}
+	}()
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"fmt"
+	"go-redis2influx/models"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// dedupEntry 同一事件代碼和等級的重複日誌
+type dedupEntry struct {
+	core   zapcore.Core // 最後一次寫入的 core (含 With 的欄位)，摘要沿用相同的輸出
+	entry  zapcore.Entry
+	fields []zapcore.Field
+	first  time.Time
+	last   time.Time
+	count  int // 上次摘要後被略過的次數
+	total  int // 全部被略過的次數
+}
+
+// dedupState 由 dedupCore 和其 With 產生的 child core 共用
+type dedupState struct {
+	sync.Mutex
+	interval time.Duration
+	entries  map[string]*dedupEntry
+}
+
+// dedupCore 包在所有輸出外面，warn 以上且帶有事件的日誌依事件代碼和等級去重
+// 第一次照常輸出，之後每隔 interval 輸出一次 "repeated N times in last X" 摘要，
+// 一整個 interval 沒有再發生時輸出 "recovered after X"
+// 同一事件代碼的 info/debug 日誌 (例如開啟輸出、分割 chunk) 不代表問題已解決，不視為恢復
+type dedupCore struct {
+	zapcore.Core
+	state  *dedupState
+	events []models.Event
+}
+
+// * 建立依事件代碼去重的 core，interval 為 0 時直接回傳原本的 core
+func newDedupCore(core zapcore.Core, interval time.Duration) zapcore.Core {
+	if interval <= 0 {
+		return core
+	}
+
+	state := &dedupState{interval: interval, entries: make(map[string]*dedupEntry)}
+	go func() {
+		for now := range time.Tick(interval) {
+			state.flush(now)
+		}
+	}()
+	return &dedupCore{Core: core, state: state}
+}
+
+func (c *dedupCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.Core = c.Core.With(fields)
+	if events := fieldEvents(fields); len(events) > 0 {
+		clone.events = append(append([]models.Event{}, c.events...), events...)
+	}
+	return &clone
+}
+
+func (c *dedupCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *dedupCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	events := append(fieldEvents(fields), c.events...)
+	if len(events) == 0 || entry.Level < zapcore.WarnLevel {
+		return write(c.Core, entry, fields)
+	}
+	event := events[0]
+
+	key := event.Code + "|" + entry.Level.String()
+	c.state.Lock()
+	e, ok := c.state.entries[key]
+	if !ok {
+		c.state.entries[key] = &dedupEntry{core: c.Core, entry: entry, fields: fields, first: entry.Time, last: entry.Time}
+		c.state.Unlock()
+		return write(c.Core, entry, fields)
+	}
+	e.core, e.entry, e.fields, e.last = c.Core, entry, fields, entry.Time
+	e.count++
+	e.total++
+	c.state.Unlock()
+	return nil
+}
+
+// 輸出重複次數的摘要，一整個 interval 沒有再發生的視為已恢復
+func (s *dedupState) flush(now time.Time) {
+	var summaries, recovered []*dedupEntry
+
+	s.Lock()
+	for key, e := range s.entries {
+		switch {
+		case e.count > 0:
+			summary := *e
+			summaries = append(summaries, &summary)
+			e.count = 0
+		case now.Sub(e.last) >= s.interval:
+			delete(s.entries, key)
+			if e.total > 0 {
+				recovered = append(recovered, e)
+			}
+		}
+	}
+	s.Unlock()
+
+	for _, e := range summaries {
+		entry := e.entry
+		entry.Time = now
+		entry.Message = fmt.Sprintf("%s (repeated %d times in last %v)", e.entry.Message, e.count, s.interval)
+		write(e.core, entry, e.fields)
+	}
+	for _, e := range recovered {
+		e.writeRecovered(e.last)
+	}
+}
+
+// 持續時間為第一次到最後一次 (last) 發生的時間，輸出時間為目前時間
+func (e *dedupEntry) writeRecovered(last time.Time) {
+	entry := e.entry
+	entry.Level = zapcore.InfoLevel
+	entry.Time = time.Now()
+	entry.Message = fmt.Sprintf("Recovered after %v: %q repeated %d times", last.Sub(e.first).Round(time.Second), e.entry.Message, e.total+1)
+	write(e.core, entry, e.fields)
+}
+
+// 依各輸出自己的等級寫入，直接呼叫 Tee 的 Write 會略過各輸出的等級判斷
+func write(core zapcore.Core, entry zapcore.Entry, fields []zapcore.Field) error {
+	if ce := core.Check(entry, nil); ce != nil {
+		ce.Write(fields...)
+	}
+	return nil
+}
+
+func fieldEvents(fields []zapcore.Field) []models.Event {
+	var events []models.Event
+	for _, field := range fields {
+		if event, ok := field.Interface.(models.Event); ok {
+			events = append(events, event)
+		}
+	}
+	return events
+}
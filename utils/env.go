@@ -2,6 +2,8 @@ package utils
 
 import (
 	"go-redis2influx/global"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 
@@ -9,173 +11,189 @@ import (
 	"os"
 
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
-	"go.uber.org/zap"
 )
 
-func LoadEnvironment() {
-	loadEnvConfigFile()
+// 環境變數前綴
+const envPrefix = "REDIS2INFLUX"
+
+// * 載入設定和事件代碼，path 為空時搜尋預設位置
+func LoadEnvironment(path string) {
+	loadEnvConfigFile(path)
 	loadEventLogConfig()
 }
 
-func loadEnvConfigFile() {
-	viper.SetConfigName("config")
-	viper.SetConfigType("yml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("/etc/go-redis2influx")
+// * 以命令列參數覆蓋設定 (例如 --log-level)，優先於設定檔和環境變數，重新載入後仍然有效
+func OverrideConfig(key string, value interface{}) {
+	viper.Set(key, value)
+}
+
+func loadEnvConfigFile(path string) {
+	if err := readConfigFile(path); err != nil {
+		// 有找到 config.yml 但是發生了其他未知的錯誤
+		panic(fmt.Sprintf("Fatal error config file: %v\n", err.Error()))
+	}
+
+	// 将配置文件内容解析到结构体中
+	config, err := decodeEnvConfig()
+	if err != nil {
+		log.Fatalf("Unable to decode into struct, %v", err)
+	}
+
+	// 一次列出所有錯誤，避免帶著錯誤的設定啟動
+	for _, key := range UnknownConfigKeys() {
+		log.Printf("Unknown config key %q, check for typos", key)
+	}
+	if err := ValidateConfig(config); err != nil {
+		log.Fatalf("Invalid config:\n%v", err)
+	}
+
+	// 檔案輸出的目錄必須可寫入且有足夠空間，否則日誌會無聲地遺失
+	if err := checkLogDirs(config); err != nil {
+		log.Fatalf("Log directory check failed: %v", err)
+	}
+
+	global.SetConfig(config)
+}
+
+// 讀取指定的設定檔，未指定時依序搜尋 . 和 /etc/go-redis2influx 下的 config.yml
+func readConfigFile(path string) error {
+	if path != "" {
+		viper.SetConfigFile(path)
+	} else {
+		viper.SetConfigName("config")
+		viper.SetConfigType("yml")
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("/etc/go-redis2influx")
+	}
+
+	// 環境變數一律疊加在設定檔之上
+	if err := bindEnv(); err != nil {
+		return err
+	}
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-
-			log.Println("沒有發現 config.yml，改抓取環境變數")
-			viper.AutomaticEnv()
-			viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+			log.Println("沒有發現 config.yml，只使用環境變數")
 		} else {
-			// 有找到 config.yml 但是發生了其他未知的錯誤
-			panic(fmt.Sprintf("Fatal error config file: %v\n", err.Error()))
+			return err
 		}
 	}
+	return nil
+}
 
-	// 创建配置结构体实例
-	var config models.EnvironmentModel
-
-	// 将配置文件内容解析到结构体中
-	if err := viper.Unmarshal(&config); err != nil {
-		log.Fatalf("Unable to decode into struct, %v", err)
+// * 將 EnvironmentModel 的每個欄位綁定到 REDIS2INFLUX_ 開頭的環境變數，例如 redis.stream_key 對應 REDIS2INFLUX_REDIS_STREAM_KEY
+// 加上 _FILE 後綴時從檔案讀取內容 (例如掛載的 secret)，outputs 以 JSON 陣列設定
+func bindEnv() error {
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(envKeyReplacer)
+	viper.AutomaticEnv()
+
+	var errs []error
+	for _, key := range envKeys() {
+		if err := viper.BindEnv(key, envName(key)); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(append(errs, loadEnvFiles())...)
+}
 
-	// 檢查路徑是否為目錄
-	if err := os.MkdirAll(config.Log.Path, os.ModePerm); err != nil {
-		global.Logger.Error(fmt.Sprintf("Create %v Error: %v", config.Log.Path, err.Error()),
-			zap.Any(global.LogEvent.LoadEnvConfig.Name, global.LogEvent.LoadEnvConfig))
+// * 讀取 _FILE 環境變數指向的檔案，重新載入設定時也會呼叫，輪替後的 secret 不需要重新啟動就能讀到
+func loadEnvFiles() error {
+	var errs []error
+	for _, key := range envKeys() {
+		name := envName(key)
+		path := os.Getenv(name + "_FILE")
+		if path == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(name); ok {
+			errs = append(errs, fmt.Errorf("both %s and %s_FILE are set", name, name))
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s_FILE: %w", name, err))
+			continue
+		}
+		viper.Set(key, strings.TrimRight(string(content), "\r\n"))
 	}
+	return errors.Join(errs...)
+}
 
-	// 加上預設檔案名稱
-	defaultFileName := "bimap.log"
-	config.Log.Path = filepath.Join(config.Log.Path, defaultFileName)
+var envKeyReplacer = strings.NewReplacer(".", "_")
 
-	global.EnvConfig = &config
-}
+// EnvironmentModel 所有葉節點的設定鍵，依字母排序
+func envKeys() []string {
+	fields := make(map[string]bool)
+	collectConfigKeys(reflect.TypeOf(models.EnvironmentModel{}), "", fields)
 
-func loadEventLogConfig() {
-	// 直接初始化 LogEvent 配置
-	global.LogEvent = &models.LogEvent{
-		OutputInfluxDB: models.Event{
-			Name:        "OutputInfluxDB",
-			Code:        "INFLUX01",
-			Category:    "InfluxDB",
-			Level:       "",
-			Threshold:   "",
-			Description: "Logs related to InfluxDB output",
-		},
-		ConnectInfluxDB: models.Event{
-			Name:        "ConnectInfluxDB",
-			Code:        "INFLUX02",
-			Category:    "InfluxDB",
-			Level:       "",
-			Threshold:   "",
-			Description: "Logs related to InfluxDB connection",
-		},
-		LoggerWrite: models.Event{
-			Name:        "LoggerWrite",
-			Code:        "LOG01",
-			Category:    "Logger",
-			Level:       "",
-			Threshold:   "",
-			Description: "Logs related to logger writing",
-		},
-		LoadEnvConfig: models.Event{
-			Name:        "LoadEnvConfig",
-			Code:        "ENV01",
-			Category:    "Config",
-			Level:       "",
-			Threshold:   "",
-			Description: "Logs related to loading environment configuration",
-		},
-		ConnectRedis: models.Event{
-			Name:        "ConnectRedis",
-			Code:        "REDIS01",
-			Category:    "Redis",
-			Level:       "",
-			Threshold:   "",
-			Description: "Logs related to establishing connection to Redis",
-		},
-		ReadRedisStream: models.Event{
-			Name:        "ReadRedisStream",
-			Code:        "REDIS02",
-			Category:    "Redis",
-			Level:       "",
-			Threshold:   "",
-			Description: "Logs related to reading from Redis Stream",
-		},
-		AckRedisMessage: models.Event{
-			Name:        "AckRedisMessage",
-			Code:        "REDIS03",
-			Category:    "Redis",
-			Level:       "",
-			Threshold:   "",
-			Description: "Logs related to acknowledging Redis messages",
-		},
-		RedisCommandError: models.Event{
-			Name:        "RedisCommandError",
-			Code:        "REDIS04",
-			Category:    "Redis",
-			Level:       "Error",
-			Threshold:   "",
-			Description: "Logs related to errors when executing Redis commands",
-		},
-		RedisConnectionLost: models.Event{
-			Name:        "RedisConnectionLost",
-			Code:        "REDIS05",
-			Category:    "Redis",
-			Level:       "Error",
-			Threshold:   "",
-			Description: "Logs related to losing connection to Redis",
-		},
-		ReconnectRedis: models.Event{
-			Name:        "ReconnectRedis",
-			Code:        "REDIS06",
-			Category:    "Redis",
-			Level:       "",
-			Threshold:   "",
-			Description: "Logs related to reconnecting to Redis after losing connection",
-		},
-		RedisWrite: models.Event{
-			Name:        "RedisWrite",
-			Code:        "REDIS07",
-			Category:    "Redis",
-			Level:       "",
-			Threshold:   "",
-			Description: "Logs related to writing data to Redis",
-		},
-		RedisGroupCreate: models.Event{
-			Name:        "RedisGroupCreate",
-			Code:        "REDIS08",
-			Category:    "Redis",
-			Level:       "",
-			Threshold:   "",
-			Description: "Logs related to creating Redis Consumer Group",
-		},
+	keys := make([]string, 0, len(fields))
+	for key, leaf := range fields {
+		if leaf {
+			keys = append(keys, key)
+		}
 	}
+	sort.Strings(keys)
+	return keys
+}
+
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(envKeyReplacer.Replace(key))
 }
 
-// func loadEventLogConfigFile() {
-// 	viper.SetConfigName("log")
-// 	viper.SetConfigType("yml")
-// 	viper.AddConfigPath(".")
+// 將 viper 目前的內容解析成設定，日誌路徑加上預設檔案名稱
+func decodeEnvConfig() (*models.EnvironmentModel, error) {
+	// 创建配置结构体实例
+	var config models.EnvironmentModel
+	hook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		jsonStringToStructSlice,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+	if err := viper.Unmarshal(&config, hook); err != nil {
+		return nil, err
+	}
 
-// 	if err := viper.ReadInConfig(); err != nil {
-// 		log.Fatalf("Error reading config file, %s", err)
-// 	}
+	// 未設定 log.sinks 時依 log.format 建立 console 和 file 兩個輸出，相對路徑放在 log.path 下
+	defaultFileName := config.Log.Filename
+	if defaultFileName == "" {
+		defaultFileName = "bimap.log"
+	}
+	if len(config.Log.Sinks) == 0 {
+		config.Log.Sinks = []models.LogSinkModel{
+			{Name: "console", Type: "stdout", Format: config.Log.Format.Console},
+			{Name: "file", Type: "file", Format: config.Log.Format.File, Path: defaultFileName},
+		}
+	}
+	for i, sink := range config.Log.Sinks {
+		if sink.Name == "" {
+			config.Log.Sinks[i].Name = sink.Type
+		}
+		if sink.Type == "file" && sink.Path != "" && !filepath.IsAbs(sink.Path) {
+			config.Log.Sinks[i].Path = filepath.Join(config.Log.Path, sink.Path)
+		}
+	}
 
-// 	var logEvent models.LogEvent
-// 	err := viper.Sub("log_event").Unmarshal(&logEvent)
-// 	if err != nil {
-// 		log.Fatalf("unable to decode into struct, %v", err)
-// 	}
+	// 加上預設檔案名稱
+	config.Log.Path = filepath.Join(config.Log.Path, defaultFileName)
 
-// 	global.LogEvent = &logEvent
+	return &config, nil
+}
 
-// }
+// 環境變數只能是字串，結構陣列 (outputs) 以 JSON 陣列表示
+func jsonStringToStructSlice(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String || to.Kind() != reflect.Slice || to.Elem().Kind() != reflect.Struct {
+		return data, nil
+	}
+	var items []map[string]interface{}
+	if err := json.Unmarshal([]byte(data.(string)), &items); err != nil {
+		return nil, fmt.Errorf("expected a JSON array: %w", err)
+	}
+	return items, nil
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadEnvFilesReread(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	path := filepath.Join(t.TempDir(), "redis_password")
+	t.Setenv("REDIS2INFLUX_REDIS_PASSWORD_FILE", path)
+
+	// 重新載入時要讀到輪替後的 secret
+	for _, secret := range []string{"first\n", "rotated\n"} {
+		if err := os.WriteFile(path, []byte(secret), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := loadEnvFiles(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := viper.GetString("redis.password"), secret[:len(secret)-1]; got != want {
+			t.Errorf("redis.password = %q, want %q", got, want)
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadEnvFiles(); err == nil {
+		t.Error("expected an error when the _FILE source is missing")
+	}
+}
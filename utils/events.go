@@ -0,0 +1,338 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"go-redis2influx/alerts"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"log"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EventEntry 事件目錄中的一筆事件，Key 為 log.yml 中 log_event 下的鍵
+type EventEntry struct {
+	Key string
+	models.Event
+}
+
+// * 載入事件目錄：先使用內建的預設值，再以 log.yml 覆蓋，驗證失敗時不啟動
+func loadEventLogConfig() {
+	logEvent, file, err := readEventLogConfig()
+	if err != nil {
+		log.Fatalf("Invalid event catalog %s:\n%v", file, err)
+	}
+	if file != "" {
+		log.Printf("Loaded event catalog from %s", file)
+	}
+	global.LogEvent = logEvent
+}
+
+// 搜尋 config.yml 所在目錄、. 和 /etc/go-redis2influx 下的 log.yml，找不到時回傳預設值
+func readEventLogConfig() (*models.LogEvent, string, error) {
+	v := viper.New()
+	v.SetConfigName("log")
+	v.SetConfigType("yml")
+	if used := viper.ConfigFileUsed(); used != "" {
+		v.AddConfigPath(filepath.Dir(used))
+	}
+	v.AddConfigPath(".")
+	v.AddConfigPath("/etc/go-redis2influx")
+
+	logEvent := defaultLogEvent()
+	if err := v.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+			return logEvent, "", nil
+		}
+		return nil, "log.yml", err
+	}
+	file := v.ConfigFileUsed()
+
+	// 只覆蓋 log.yml 中有設定的欄位
+	if err := v.UnmarshalKey("log_event", logEvent); err != nil {
+		return nil, file, err
+	}
+
+	var errs []error
+	known := make(map[string]bool)
+	for _, entry := range eventEntries(logEvent) {
+		known[entry.Key] = true
+	}
+	for key := range v.GetStringMap("log_event") {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("log_event.%s is not an event used by the code", key))
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+
+	if err := ValidateLogEvent(logEvent); err != nil {
+		errs = append(errs, err)
+	}
+	return logEvent, file, errors.Join(errs...)
+}
+
+// * 檢查程式中使用的每個事件都有名稱和代碼，代碼不可重複，等級必須是 zap 的等級
+func ValidateLogEvent(logEvent *models.LogEvent) error {
+	var errs configErrors
+	codes := make(map[string]string)
+
+	for _, entry := range eventEntries(logEvent) {
+		key := "log_event." + entry.Key
+		errs.required(key+".name", entry.Name)
+		errs.required(key+".code", entry.Code)
+		if other, ok := codes[entry.Code]; ok && entry.Code != "" {
+			errs.add("%s.code %q is already used by log_event.%s", key, entry.Code, other)
+		}
+		codes[entry.Code] = entry.Key
+
+		switch strings.ToLower(entry.Level) {
+		case "", "debug", "info", "warn", "error":
+		default:
+			errs.add("%s.level %q must be one of debug, info, warn, error", key, entry.Level)
+		}
+		if _, _, err := alerts.ParseThreshold(entry.Threshold); err != nil {
+			errs.add("%s.%v", key, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// * 目前生效的事件目錄，依 models.LogEvent 的欄位順序
+func EventCatalog() []EventEntry {
+	return eventEntries(global.LogEvent)
+}
+
+func catalogEvents() []models.Event {
+	entries := EventCatalog()
+	events := make([]models.Event, len(entries))
+	for i, entry := range entries {
+		events[i] = entry.Event
+	}
+	return events
+}
+
+func eventEntries(logEvent *models.LogEvent) []EventEntry {
+	v := reflect.ValueOf(logEvent).Elem()
+	t := v.Type()
+
+	entries := make([]EventEntry, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		event, ok := v.Field(i).Interface().(models.Event)
+		if !ok {
+			continue
+		}
+		entries = append(entries, EventEntry{Key: t.Field(i).Tag.Get("mapstructure"), Event: event})
+	}
+	return entries
+}
+
+// 內建的事件代碼，沒有 log.yml 或 log.yml 未設定的欄位使用這些值
+func defaultLogEvent() *models.LogEvent {
+	return &models.LogEvent{
+		OutputInfluxDB: models.Event{
+			Name:        "OutputInfluxDB",
+			Code:        "INFLUX01",
+			Category:    "InfluxDB",
+			Level:       "",
+			Threshold:   "5 in 1m",
+			Description: "Logs related to InfluxDB output",
+		},
+		ConnectInfluxDB: models.Event{
+			Name:        "ConnectInfluxDB",
+			Code:        "INFLUX02",
+			Category:    "InfluxDB",
+			Level:       "",
+			Threshold:   "3 in 5m",
+			Description: "Logs related to InfluxDB connection",
+		},
+		CircuitBreaker: models.Event{
+			Name:        "CircuitBreaker",
+			Code:        "INFLUX03",
+			Category:    "InfluxDB",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to output circuit breaker state transitions",
+		},
+		InfluxDBDown: models.Event{
+			Name:        "InfluxDBDown",
+			Code:        "INFLUX04",
+			Category:    "InfluxDB",
+			Level:       "",
+			Threshold:   "",
+			Description: "A required output has been unavailable longer than notify.influx_down_minutes",
+		},
+		LoggerWrite: models.Event{
+			Name:        "LoggerWrite",
+			Code:        "LOG01",
+			Category:    "Logger",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to logger writing",
+		},
+		LoadEnvConfig: models.Event{
+			Name:        "LoadEnvConfig",
+			Code:        "ENV01",
+			Category:    "Config",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to loading environment configuration",
+		},
+		HTTPServer: models.Event{
+			Name:        "HTTPServer",
+			Code:        "HTTP01",
+			Category:    "HTTP",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to the metrics and admin HTTP server",
+		},
+		AdminAPI: models.Event{
+			Name:        "AdminAPI",
+			Code:        "HTTP02",
+			Category:    "HTTP",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to admin API requests such as pause, resume, drain and flush",
+		},
+		Alerting: models.Event{
+			Name:        "Alerting",
+			Code:        "ALERT01",
+			Category:    "Alerting",
+			Level:       "",
+			Threshold:   "",
+			Description: "Alerts fired and resolved when an event crosses its threshold",
+		},
+		Webhook: models.Event{
+			Name:        "Webhook",
+			Code:        "NOTIFY01",
+			Category:    "Alerting",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to sending webhook notifications",
+		},
+		RejectedSpike: models.Event{
+			Name:        "RejectedSpike",
+			Code:        "DATA01",
+			Category:    "Alerting",
+			Level:       "",
+			Threshold:   "",
+			Description: "Rejected lines per minute exceeded notify.rejected_per_minute",
+		},
+		QuarantineData: models.Event{
+			Name:        "QuarantineData",
+			Code:        "DATA02",
+			Category:    "Data",
+			Level:       "",
+			Threshold:   "",
+			Description: "Messages rejected by an output as bad data were moved to the dead-letter stream",
+		},
+		SelfTelemetry: models.Event{
+			Name:        "SelfTelemetry",
+			Code:        "STAT01",
+			Category:    "Telemetry",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to writing the bridge's own statistics",
+		},
+		EventLog: models.Event{
+			Name:        "EventLog",
+			Code:        "STAT02",
+			Category:    "Telemetry",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to writing warn and error events to the events bucket",
+		},
+		ConnectRedis: models.Event{
+			Name:        "ConnectRedis",
+			Code:        "REDIS01",
+			Category:    "Redis",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to establishing connection to Redis",
+		},
+		ReadRedisStream: models.Event{
+			Name:        "ReadRedisStream",
+			Code:        "REDIS02",
+			Category:    "Redis",
+			Level:       "",
+			Threshold:   "5 in 1m",
+			Description: "Logs related to reading from Redis Stream",
+		},
+		AckRedisMessage: models.Event{
+			Name:        "AckRedisMessage",
+			Code:        "REDIS03",
+			Category:    "Redis",
+			Level:       "",
+			Threshold:   "3 in 5m",
+			Description: "Logs related to acknowledging Redis messages",
+		},
+		RedisCommandError: models.Event{
+			Name:        "RedisCommandError",
+			Code:        "REDIS04",
+			Category:    "Redis",
+			Level:       "Error",
+			Threshold:   "5 in 1m",
+			Description: "Logs related to errors when executing Redis commands",
+		},
+		RedisConnectionLost: models.Event{
+			Name:        "RedisConnectionLost",
+			Code:        "REDIS05",
+			Category:    "Redis",
+			Level:       "Error",
+			Threshold:   "",
+			Description: "Logs related to losing connection to Redis",
+		},
+		ReconnectRedis: models.Event{
+			Name:        "ReconnectRedis",
+			Code:        "REDIS06",
+			Category:    "Redis",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to reconnecting to Redis after losing connection",
+		},
+		RedisWrite: models.Event{
+			Name:        "RedisWrite",
+			Code:        "REDIS07",
+			Category:    "Redis",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to writing data to Redis",
+		},
+		RedisGroupCreate: models.Event{
+			Name:        "RedisGroupCreate",
+			Code:        "REDIS08",
+			Category:    "Redis",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to creating Redis Consumer Group",
+		},
+		StreamMonitor: models.Event{
+			Name:        "StreamMonitor",
+			Code:        "REDIS09",
+			Category:    "Redis",
+			Level:       "",
+			Threshold:   "",
+			Description: "Logs related to consumer group lag and backlog monitoring",
+		},
+		PendingGrowth: models.Event{
+			Name:        "PendingGrowth",
+			Code:        "REDIS10",
+			Category:    "Redis",
+			Level:       "",
+			Threshold:   "",
+			Description: "The pending entries list kept growing for notify.pending_growth_checks monitor checks",
+		},
+		ConsumerStopped: models.Event{
+			Name:        "ConsumerStopped",
+			Code:        "REDIS11",
+			Category:    "Redis",
+			Level:       "",
+			Threshold:   "",
+			Description: "The consumer stopped after an auth or config error and waits for the admin resume endpoint",
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"fmt"
+	"go-redis2influx/models"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// * 啟動前檢查所有檔案輸出的目錄：不存在時建立、可寫入，且剩餘空間不少於 log.min_free_mb
+// min_free_mb 未設定時至少要能寫滿一個 maxsize 的檔案
+func checkLogDirs(config *models.EnvironmentModel) error {
+	minFree := config.Log.MinFreeMB
+	if minFree == 0 {
+		minFree = config.Log.MaxSize
+	}
+
+	checked := make(map[string]bool)
+	for _, sink := range config.Log.Sinks {
+		if sink.Type != "file" {
+			continue
+		}
+		dir := filepath.Dir(sink.Path)
+		if checked[dir] {
+			continue
+		}
+		checked[dir] = true
+
+		if err := checkLogDir(dir, minFree); err != nil {
+			return fmt.Errorf("log.sinks %s: %w", sink.Name, err)
+		}
+	}
+	return nil
+}
+
+func checkLogDir(dir string, minFreeMB int) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return fmt.Errorf("check free space of %s: %w", dir, err)
+	}
+	freeMB := stat.Bavail * uint64(stat.Bsize) / 1024 / 1024
+	if freeMB < uint64(minFreeMB) {
+		return fmt.Errorf("%s has %d MB free, need at least %d MB", dir, freeMB, minFreeMB)
+	}
+	return nil
+}
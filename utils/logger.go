@@ -1,57 +1,55 @@
 package utils
 
 import (
+	"go-redis2influx/alerts"
+	"go-redis2influx/databases"
 	"go-redis2influx/global"
-
-	"os"
-	"path/filepath"
+	"go-redis2influx/models"
+	"log"
 	"time"
 
-	"github.com/natefinch/lumberjack"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+// 上一次 InitLogger 建立的輸出的停止通道，重新建立輸出時關閉以結束每日切割
+var sinkStop chan struct{}
+
+// * 依 log.sinks 建立所有輸出，未設定時為 console 和 file 兩個輸出
 func InitLogger() {
 	var logger *zap.Logger
-	cfg := zap.NewDevelopmentConfig()
-
-	c := zapcore.EncoderConfig{
-		TimeKey:        "time",
-		LevelKey:       "level",
-		NameKey:        "logger",
-		CallerKey:      "caller",
-		MessageKey:     "message",
-		StacktraceKey:  "stack",
-		EncodeLevel:    zapcore.CapitalColorLevelEncoder, // 大寫帶顏色
-		EncodeCaller:   zapcore.ShortCallerEncoder,
-		EncodeDuration: zapcore.SecondsDurationEncoder,
-		EncodeTime: func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-			enc.AppendString(t.Format("2006-01-02 15:04:05"))
-		},
-	}
 
-	cfg.EncoderConfig = c
+	sinks := global.Config().Log.Sinks
+	initSinkLevels(sinks, global.Config().Log.Level)
 
-	level := global.EnvConfig.Log.Level
+	if sinkStop != nil {
+		close(sinkStop)
+	}
+	sinkStop = make(chan struct{})
+
+	cores := make([]zapcore.Core, 0, len(sinks))
+	for i, sink := range sinks {
+		core, err := newSinkCore(sink, sinkLevels[sink.Name].level, sinkStop)
+		if err != nil {
+			log.Fatalf("log.sinks[%d] (%s): %v", i, sink.Name, err)
+		}
+		cores = append(cores, core)
+	}
 
 	core := zapcore.NewTee(
-		// 1. console & db
-		zapcore.NewCore(CustomLogConsole(), zapcore.AddSync(os.Stdout), DefaultLogLevel(level)),
+		// 重複的 warn/error 只輸出第一次和定期摘要
+		newDedupCore(zapcore.NewTee(cores...), time.Duration(global.Config().Log.DedupInterval)*time.Second),
 
-		// 2. file
-		zapcore.NewCore(
-			CustomLogFile(),
-			DefaultRotateWriteSyncer(),
-			DefaultLogLevel(level)),
+		// 依事件門檻觸發告警，不輸出內容，每次發生都要計入所以不去重
+		alerts.NewCore(catalogEvents()),
+
+		// warn/error 事件寫入 events.bucket，與資料一起顯示在 dashboard 上
+		databases.NewEventLogCore(),
 	)
 
 	// caller 顯示文件名、行號和zap調用者的函數名
-	if global.EnvConfig.Log.Level == "debug" {
-		logger = zap.New(core, zap.AddCaller())
-	} else {
-		logger = zap.New(core)
-	}
+	// 執行期間可以把等級調整為 debug，所以不依啟動時的等級決定是否加上 caller
+	logger = zap.New(core, zap.AddCaller())
 
 	global.Logger = logger
 
@@ -97,202 +95,72 @@ func CustomLogFile() zapcore.Encoder {
 	return encoder
 }
 
-// error > warn > info > debug
-func DefaultLogLevel(level string) zap.LevelEnablerFunc {
-	var priority zap.LevelEnablerFunc
-
-	switch level {
-	case "error": // error
-		highPriority := zap.LevelEnablerFunc(func(lev zapcore.Level) bool {
-			return lev >= zap.ErrorLevel
-		})
-		priority = highPriority
-
-	case "info": // warn + info
-		lowPriority := zap.LevelEnablerFunc(func(lev zapcore.Level) bool {
-			return lev <= zap.ErrorLevel && lev > zap.DebugLevel
-		})
-		priority = lowPriority
-	case "debug": // warn + info + debug
-		lowPriority := zap.LevelEnablerFunc(func(lev zapcore.Level) bool {
-			return lev <= zap.ErrorLevel && lev >= zap.DebugLevel
-		})
-		priority = lowPriority
-	}
-
-	return priority
-}
-
-// *** 日誌切割 ***//
-// lumberjack：如果 MaxBackups 和 MaxAge均為 0，則不會刪除任何舊的日誌檔。
-func DefaultRotateWriteSyncer() zapcore.WriteSyncer {
-	cfg := global.EnvConfig.Log
-	var fileWriteSyncer zapcore.WriteSyncer
-	logPath := global.EnvConfig.Log.Path
-	fileWriteSyncer = zapcore.AddSync(&lumberjack.Logger{
-		Filename: logPath,     // 日誌文件存放目錄，如果文件夾不存在會自動創建
-		MaxSize:  cfg.MaxSize, // 文件大小限制,單位MB
-		MaxAge:   cfg.MaxAge,  // 日誌文件保留天數
-		//Compress:   false,   // 是否壓縮處理
+// *** journald / syslog ***//
+// 時間和等級由 journald 或 syslog 記錄，不重複輸出
+func CustomLogSystem() zapcore.Encoder {
+	return zapcore.NewConsoleEncoder(zapcore.EncoderConfig{
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		MessageKey:     "message",
+		StacktraceKey:  "stack",
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+		EncodeDuration: zapcore.SecondsDurationEncoder,
 	})
-
-	return fileWriteSyncer
-}
-
-// *** Custom ***//
-func CustomLogLevel(level string) zap.LevelEnablerFunc {
-	var priority zap.LevelEnablerFunc
-
-	switch level {
-	case "error": // error
-		highPriority := zap.LevelEnablerFunc(func(lev zapcore.Level) bool {
-			return lev >= zap.ErrorLevel
-		})
-		priority = highPriority
-
-	case "info": // warn + info
-		lowPriority := zap.LevelEnablerFunc(func(lev zapcore.Level) bool {
-			return lev < zap.ErrorLevel && lev > zap.DebugLevel
-		})
-		priority = lowPriority
-	case "debug": // warn + info + debug
-		lowPriority := zap.LevelEnablerFunc(func(lev zapcore.Level) bool {
-			return lev <= zap.ErrorLevel && lev >= zap.DebugLevel
-		})
-		priority = lowPriority
-	}
-
-	return priority
 }
 
-// *** Custom ***//
-// lumberjack：如果 MaxBackups 和 MaxAge均為 0，則不會刪除任何舊的日誌檔。
-func CustomRotateWriteSyncer(level string) zapcore.WriteSyncer {
-	cfg := global.EnvConfig.Log
-	var fileWriteSyncer zapcore.WriteSyncer
-	switch level {
-	case "error":
-		filePath := filepath.Join(cfg.Path, "error.json")
-		fileWriteSyncer = zapcore.AddSync(&lumberjack.Logger{
-			Filename: filePath,    // 日誌文件存放目錄，如果文件夾不存在會自動創建
-			MaxSize:  cfg.MaxSize, // 文件大小限制,單位MB
-			MaxAge:   cfg.MaxAge,  // 日誌文件保留天數
-			//Compress:   false,   // 是否壓縮處理
-		})
-	case "info", "debug":
-		filePath := filepath.Join(cfg.Path, "info.json")
-		fileWriteSyncer = zapcore.AddSync(&lumberjack.Logger{
-			Filename: filePath,    // 日誌文件存放目錄，如果文件夾不存在會自動創建
-			MaxSize:  cfg.MaxSize, // 文件大小限制,單位MB
-			MaxAge:   cfg.MaxAge,  // 日誌文件保留天數
-			//Compress:   false,   // 是否壓縮處理
-		})
-	}
-	return fileWriteSyncer
-}
-
-// *** Custom ***//
-func CustomInitLogger() {
-	var logger *zap.Logger
-	cfg := zap.NewDevelopmentConfig()
-
-	c := zapcore.EncoderConfig{
+// *** JSON 格式 ***//
+// 時間為含毫秒的 RFC3339，方便送進 Loki 或 Elasticsearch
+func CustomLogJSON() zapcore.Encoder {
+	return zapcore.NewJSONEncoder(zapcore.EncoderConfig{
 		TimeKey:        "time",
 		LevelKey:       "level",
 		NameKey:        "logger",
 		CallerKey:      "caller",
 		MessageKey:     "message",
 		StacktraceKey:  "stack",
-		EncodeLevel:    zapcore.CapitalColorLevelEncoder, // 大寫帶顏色
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
 		EncodeCaller:   zapcore.ShortCallerEncoder,
 		EncodeDuration: zapcore.SecondsDurationEncoder,
-		EncodeTime: func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-			enc.AppendString(t.Format("2006-01-02 15:04:05"))
-		},
-	}
-
-	cfg.EncoderConfig = c
-
-	level := global.EnvConfig.Log.Level
-
-	switch level {
-	case "error": // error
-		core := zapcore.NewTee(
-			//************ error ************//
-			// 1. console
-			zapcore.NewCore(
-				CustomLogConsole(),
-				zapcore.Lock(zapcore.AddSync(os.Stdout)),
-				CustomLogLevel("error")),
-			// 2. file
-			zapcore.NewCore(
-				CustomLogFile(),
-				CustomRotateWriteSyncer("error"),
-				CustomLogLevel("error")),
-		)
-		logger = zap.New(core)
-	case "info": // error + warn + info
-		core := zapcore.NewTee(
-			//************ error ************//
-			// 1. console
-			// zapcore.NewCore(
-			// 	CustomLogConsole(),
-			// 	zapcore.Lock(zapcore.AddSync(os.Stdout)),
-			// 	CustomLogLevel("error")),
-			// 2. file
-			zapcore.NewCore(
-				CustomLogFile(),
-				CustomRotateWriteSyncer("error"),
-				CustomLogLevel("error")),
-
-			//************ info ************//
-			// 1. console
-			// zapcore.NewCore(
-			// 	CustomLogConsole(),
-			// 	zapcore.Lock(zapcore.AddSync(os.Stdout)),
-			// 	CustomLogLevel(level)),
-			// 2, file
-			zapcore.NewCore(
-				CustomLogFile(),
-				CustomRotateWriteSyncer(level),
-				CustomLogLevel(level)),
-		)
+		EncodeTime:     zapcore.TimeEncoderOfLayout("2006-01-02T15:04:05.000Z07:00"),
+	})
+}
 
-		// caller 顯示文件名、行號和zap調用者的函數名
-		logger = zap.New(core, zap.AddCaller())
+// eventCore 將 zap.Any(name, models.Event) 攤平成 event、code、category、event_level 欄位
+type eventCore struct {
+	zapcore.Core
+}
 
-	case "debug": // error + warn + info + debug
-		core := zapcore.NewTee(
-			//************ error ************//
-			// 1. console
-			// zapcore.NewCore(
-			// 	CustomLogConsole(),
-			// 	zapcore.Lock(zapcore.AddSync(os.Stdout)),
-			// 	CustomLogLevel("error")),
-			// 2. file
-			zapcore.NewCore(
-				CustomLogFile(),
-				CustomRotateWriteSyncer("error"),
-				CustomLogLevel("error")),
-			// 3. db
-			//&HookCore{Core: hook.Core()},
+func (c *eventCore) With(fields []zapcore.Field) zapcore.Core {
+	return &eventCore{Core: c.Core.With(flattenEvents(fields))}
+}
 
-			//************ info ************//
-			// 1. console
-			// zapcore.NewCore(
-			// 	CustomLogConsole(),
-			// 	zapcore.Lock(zapcore.AddSync(os.Stdout)),
-			// 	CustomLogLevel(level)),
-			// 2, file
-			zapcore.NewCore(
-				CustomLogFile(),
-				CustomRotateWriteSyncer(level),
-				CustomLogLevel(level)),
-		)
+func (c *eventCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
 
-		// caller 顯示文件名、行號和zap調用者的函數名
-		logger = zap.New(core, zap.AddCaller())
+func (c *eventCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, flattenEvents(fields))
+}
 
+func flattenEvents(fields []zapcore.Field) []zapcore.Field {
+	flattened := make([]zapcore.Field, 0, len(fields)+3)
+	for _, field := range fields {
+		event, ok := field.Interface.(models.Event)
+		if !ok {
+			flattened = append(flattened, field)
+			continue
+		}
+		flattened = append(flattened,
+			zap.String("event", event.Name),
+			zap.String("code", event.Code),
+			zap.String("category", event.Category))
+		if event.Level != "" {
+			flattened = append(flattened, zap.String("event_level", event.Level))
+		}
 	}
-	global.Logger = logger
+	return flattened
 }
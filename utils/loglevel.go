@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 暫時調整的等級在 log.level_timeout 未設定時的還原時間
+const defaultLevelTimeout = 10 * time.Minute
+
+// sinkLevel 單一輸出的日誌等級，暫時調整後到時自動還原為設定檔的等級
+// 未設定 level 的輸出沿用 log.level，重新載入設定時一起變更
+type sinkLevel struct {
+	mu         sync.Mutex
+	level      zap.AtomicLevel
+	configured zapcore.Level
+	inherit    bool
+	revertAt   time.Time
+	timer      *time.Timer
+}
+
+// 可個別調整等級的輸出，依輸出名稱區分
+var sinkLevels = map[string]*sinkLevel{}
+
+// 依 log.sinks 建立每個輸出的等級
+func initSinkLevels(sinks []models.LogSinkModel, level string) {
+	sinkLevels = make(map[string]*sinkLevel, len(sinks))
+	for _, sink := range sinks {
+		s := &sinkLevel{level: zap.NewAtomicLevel(), inherit: sink.Level == ""}
+		if s.inherit {
+			s.configured = parseLogLevel(level)
+		} else {
+			s.configured = parseLogLevel(sink.Level)
+		}
+		s.level.SetLevel(s.configured)
+		sinkLevels[sink.Name] = s
+	}
+}
+
+// 未知的等級視為 info
+func parseLogLevel(level string) zapcore.Level {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return zapcore.InfoLevel
+	}
+	return lvl
+}
+
+// LogLevelStatus 單一輸出目前的等級，供 /admin/loglevel 回報
+type LogLevelStatus struct {
+	Sink       string     `json:"sink"`
+	Level      string     `json:"level"`
+	Configured string     `json:"configured"`
+	RevertAt   *time.Time `json:"revert_at,omitempty"`
+}
+
+// * 套用 log.level 到沒有自己設定 level 的輸出，暫時調整中的輸出在還原時才套用
+func SetLogLevel(level string) {
+	configured := parseLogLevel(level)
+
+	for _, s := range sinkLevels {
+		if !s.inherit {
+			continue
+		}
+		s.mu.Lock()
+		s.configured = configured
+		if s.timer == nil {
+			s.level.SetLevel(configured)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// * 暫時調整輸出的日誌等級，sink 為 log.sinks 的名稱，空字串時調整所有輸出，timeout 後自動還原
+// timeout 為 0 時使用 log.level_timeout
+func OverrideLogLevel(sink, level string, timeout time.Duration) ([]LogLevelStatus, error) {
+	sinks, err := selectSinks(sink)
+	if err != nil {
+		return nil, err
+	}
+	var lvl zapcore.Level
+	switch level {
+	case "debug", "info", "warn", "error":
+		lvl, _ = zapcore.ParseLevel(level)
+	default:
+		return nil, fmt.Errorf("level %q must be one of debug, info, warn, error", level)
+	}
+	if timeout <= 0 {
+		timeout = time.Duration(global.Config().Log.LevelTimeout) * time.Second
+	}
+	if timeout <= 0 {
+		timeout = defaultLevelTimeout
+	}
+
+	for _, name := range sinks {
+		// Go 1.21 的迴圈變數在每次迭代間共用，AfterFunc 必須捕捉這次迭代的副本
+		name := name
+		s := sinkLevels[name]
+		s.mu.Lock()
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		s.level.SetLevel(lvl)
+		s.revertAt = time.Now().Add(timeout)
+		s.timer = time.AfterFunc(timeout, func() { s.revert(name, false) })
+		s.mu.Unlock()
+	}
+
+	global.Logger.Info(fmt.Sprintf("Log level of %v set to %s, reverting in %v", sinks, level, timeout),
+		zap.Any(global.LogEvent.LoggerWrite.Name, global.LogEvent.LoggerWrite))
+	return LogLevels(), nil
+}
+
+// * 立即將輸出還原為設定檔的等級，sink 為空字串時還原所有輸出
+func ResetLogLevel(sink string) ([]LogLevelStatus, error) {
+	sinks, err := selectSinks(sink)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sinks {
+		sinkLevels[name].revert(name, true)
+	}
+	return LogLevels(), nil
+}
+
+// 到期還原時，若期間又被調整過 (revertAt 延後) 則略過
+func (s *sinkLevel) revert(name string, reset bool) {
+	s.mu.Lock()
+	if s.timer == nil || (!reset && time.Now().Before(s.revertAt)) {
+		s.mu.Unlock()
+		return
+	}
+	s.timer.Stop()
+	s.timer = nil
+	s.revertAt = time.Time{}
+	s.level.SetLevel(s.configured)
+	configured := s.configured
+	s.mu.Unlock()
+
+	global.Logger.Info(fmt.Sprintf("Log level of %s reverted to %s", name, configured),
+		zap.Any(global.LogEvent.LoggerWrite.Name, global.LogEvent.LoggerWrite))
+}
+
+// * 所有輸出目前的日誌等級
+func LogLevels() []LogLevelStatus {
+	statuses := make([]LogLevelStatus, 0, len(sinkLevels))
+	for _, name := range sinkNames() {
+		s := sinkLevels[name]
+		s.mu.Lock()
+		status := LogLevelStatus{Sink: name, Level: s.level.Level().String(), Configured: s.configured.String()}
+		if !s.revertAt.IsZero() {
+			revertAt := s.revertAt
+			status.RevertAt = &revertAt
+		}
+		s.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// * 收到 SIGUSR1 時將所有輸出暫時調整為 debug，SIGUSR2 時立即還原
+func WatchLogLevelSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGUSR1 {
+				OverrideLogLevel("", "debug", 0)
+			} else {
+				ResetLogLevel("")
+			}
+		}
+	}()
+}
+
+func selectSinks(sink string) ([]string, error) {
+	if sink == "" {
+		return sinkNames(), nil
+	}
+	if _, ok := sinkLevels[sink]; !ok {
+		return nil, fmt.Errorf("unknown sink %q, must be one of %v", sink, sinkNames())
+	}
+	return []string{sink}, nil
+}
+
+func sinkNames() []string {
+	names := make([]string, 0, len(sinkLevels))
+	for name := range sinkLevels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
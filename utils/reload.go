@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// restartSetting 執行期間無法套用的設定，變更時保留原本的值並記錄需要重新啟動
+type restartSetting struct {
+	key   string
+	field func(c *models.EnvironmentModel) interface{}
+}
+
+// 其餘設定 (log.level、redis.count、redis.block_ms、redis.retry_delay、writer、monitor 門檻、health、circuit_breaker) 每次使用時重新讀取，可直接套用
+var restartSettings = []restartSetting{
+	{"redis.address", func(c *models.EnvironmentModel) interface{} { return &c.Redis.Address }},
+	{"redis.password", func(c *models.EnvironmentModel) interface{} { return &c.Redis.Password }},
+	{"redis.db", func(c *models.EnvironmentModel) interface{} { return &c.Redis.DB }},
+	{"redis.group_name", func(c *models.EnvironmentModel) interface{} { return &c.Redis.GroupName }},
+	{"redis.consumer_name", func(c *models.EnvironmentModel) interface{} { return &c.Redis.ConsumerName }},
+	{"redis.stream_key", func(c *models.EnvironmentModel) interface{} { return &c.Redis.StreamKey }},
+	{"influxdb", func(c *models.EnvironmentModel) interface{} { return &c.Influxdb }},
+	{"outputs", func(c *models.EnvironmentModel) interface{} { return &c.Outputs }},
+	{"http", func(c *models.EnvironmentModel) interface{} { return &c.HTTP }},
+	{"admin", func(c *models.EnvironmentModel) interface{} { return &c.Admin }},
+	{"telemetry", func(c *models.EnvironmentModel) interface{} { return &c.Telemetry }},
+	{"events", func(c *models.EnvironmentModel) interface{} { return &c.Events }},
+	{"monitor.interval", func(c *models.EnvironmentModel) interface{} { return &c.Monitor.Interval }},
+	{"log.path", func(c *models.EnvironmentModel) interface{} { return &c.Log.Path }},
+	{"log.maxsize", func(c *models.EnvironmentModel) interface{} { return &c.Log.MaxSize }},
+	{"log.maxage", func(c *models.EnvironmentModel) interface{} { return &c.Log.MaxAge }},
+	{"log.maxbackups", func(c *models.EnvironmentModel) interface{} { return &c.Log.MaxBackups }},
+	{"log.compress", func(c *models.EnvironmentModel) interface{} { return &c.Log.Compress }},
+	{"log.localtime", func(c *models.EnvironmentModel) interface{} { return &c.Log.LocalTime }},
+	{"log.rotate", func(c *models.EnvironmentModel) interface{} { return &c.Log.Rotate }},
+	{"log.dedup_interval", func(c *models.EnvironmentModel) interface{} { return &c.Log.DedupInterval }},
+	{"log.format", func(c *models.EnvironmentModel) interface{} { return &c.Log.Format }},
+	{"log.sinks", func(c *models.EnvironmentModel) interface{} { return &c.Log.Sinks }},
+	{"notify", func(c *models.EnvironmentModel) interface{} { return &c.Notify }},
+}
+
+// 設定檔的讀取、解析和替換都在 reloadMu 內進行，檔案變更和 SIGHUP 同時觸發時不會交錯
+var reloadMu sync.Mutex
+
+// * 監看 config.yml 的變更並在收到 SIGHUP 時重新載入，onReload 在新設定生效後呼叫
+// 只使用環境變數 (沒有 config.yml) 時不啟用
+func WatchConfig(onReload ...func()) {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		return
+	}
+
+	reload := func() {
+		if ReloadConfig() {
+			for _, fn := range onReload {
+				fn()
+			}
+		}
+	}
+
+	// 不使用 viper.WatchConfig，它會在自己的 goroutine 中不加鎖地呼叫 ReadInConfig
+	if err := watchConfigFile(file, reload); err != nil {
+		global.Logger.Warn(fmt.Sprintf("Unable to watch %s, reload with SIGHUP instead: %v", file, err),
+			zap.Any(global.LogEvent.LoadEnvConfig.Name, global.LogEvent.LoadEnvConfig))
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			global.Logger.Info("Received SIGHUP, reloading config",
+				zap.Any(global.LogEvent.LoadEnvConfig.Name, global.LogEvent.LoadEnvConfig))
+			reload()
+		}
+	}()
+}
+
+// 監看設定檔所在的目錄，編輯器以改名方式存檔或 Kubernetes ConfigMap 替換 symlink 時也能偵測到
+func watchConfigFile(file string, reload func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	file = filepath.Clean(file)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	realFile, _ := filepath.EvalSymlinks(file)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				current, _ := filepath.EvalSymlinks(file)
+				written := filepath.Clean(e.Name) == file && e.Op&(fsnotify.Write|fsnotify.Create) != 0
+				if !written && (current == "" || current == realFile) {
+					continue
+				}
+				realFile = current
+				global.Logger.Info(fmt.Sprintf("Detected change of %s (%s)", e.Name, e.Op),
+					zap.Any(global.LogEvent.LoadEnvConfig.Name, global.LogEvent.LoadEnvConfig))
+				reload()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				global.Logger.Warn(fmt.Sprintf("Config watcher error: %v", err),
+					zap.Any(global.LogEvent.LoadEnvConfig.Name, global.LogEvent.LoadEnvConfig))
+			}
+		}
+	}()
+	return nil
+}
+
+// * 重新讀取設定檔，解析並驗證通過後整份替換目前的設定
+// 需要重新啟動的設定保留原本的值，回傳是否已套用新設定
+func ReloadConfig() bool {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	event := zap.Any(global.LogEvent.LoadEnvConfig.Name, global.LogEvent.LoadEnvConfig)
+
+	if err := viper.ReadInConfig(); err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to read %s, keeping current config: %v", viper.ConfigFileUsed(), err), event)
+		return false
+	}
+	if err := loadEnvFiles(); err != nil {
+		global.Logger.Error(fmt.Sprintf("Failed to read _FILE environment variables, keeping current config: %s", strings.ReplaceAll(err.Error(), "\n", "; ")), event)
+		return false
+	}
+
+	config, err := decodeEnvConfig()
+	if err == nil {
+		err = ValidateConfig(config)
+	}
+	if err != nil {
+		global.Logger.Error(fmt.Sprintf("Rejected config reload, keeping current config: %s", strings.ReplaceAll(err.Error(), "\n", "; ")), event)
+		return false
+	}
+
+	current := global.Config()
+	for _, setting := range restartSettings {
+		old := reflect.ValueOf(setting.field(current)).Elem()
+		changed := reflect.ValueOf(setting.field(config)).Elem()
+		if reflect.DeepEqual(old.Interface(), changed.Interface()) {
+			continue
+		}
+		global.Logger.Warn(fmt.Sprintf("Setting %s cannot be changed at runtime, restart required; keeping current value", setting.key), event)
+		changed.Set(old)
+	}
+
+	if reflect.DeepEqual(current, config) {
+		global.Logger.Info("Config reloaded, no applicable changes", event)
+		return false
+	}
+
+	// 新設定建立完成後才替換指標，讀取端不會看到只更新一半的設定
+	global.SetConfig(config)
+	if config.Log.Level != current.Log.Level {
+		SetLogLevel(config.Log.Level)
+	}
+
+	global.Logger.Info(fmt.Sprintf("Config reloaded, log level %s, count %d, block_ms %d, retry_delay %d",
+		config.Log.Level, config.Redis.Count, config.Redis.BlockMs, config.Redis.RetryDelay), event)
+	return true
+}
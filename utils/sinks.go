@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"go-redis2influx/global"
+	"go-redis2influx/models"
+	"log"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/natefinch/lumberjack"
+	"go.uber.org/zap/zapcore"
+)
+
+// journald 的 native protocol socket
+const journalSocket = "/run/systemd/journal/socket"
+
+// * 依 log.sinks 建立單一輸出，等級範圍為 enab 且不高於 max_level
+// stop 關閉時停止 file 輸出的每日切割
+func newSinkCore(sink models.LogSinkModel, enab zapcore.LevelEnabler, stop <-chan struct{}) (zapcore.Core, error) {
+	if sink.MaxLevel != "" {
+		maxLevel, _ := zapcore.ParseLevel(sink.MaxLevel)
+		enab = levelRange{min: enab, max: maxLevel}
+	}
+
+	var core zapcore.Core
+	switch sink.Type {
+	case "stdout":
+		core = zapcore.NewCore(sinkEncoder(sink.Format, CustomLogConsole()), zapcore.Lock(zapcore.AddSync(os.Stdout)), enab)
+	case "file":
+		core = zapcore.NewCore(sinkEncoder(sink.Format, CustomLogFile()), rotateWriteSyncer(sink, stop), enab)
+	case "journald":
+		conn, err := net.Dial("unixgram", journalSocket)
+		if err != nil {
+			return nil, fmt.Errorf("connect to journald: %w", err)
+		}
+		core = &priorityCore{LevelEnabler: enab, enc: sinkEncoder(sink.Format, CustomLogSystem()), write: journaldWriter(conn, sinkTag(sink))}
+	case "syslog":
+		w, err := syslog.Dial(sink.Network, sink.Address, syslog.LOG_DAEMON, sinkTag(sink))
+		if err != nil {
+			return nil, fmt.Errorf("connect to syslog: %w", err)
+		}
+		core = &priorityCore{LevelEnabler: enab, enc: sinkEncoder(sink.Format, CustomLogSystem()), write: syslogWriter(w)}
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", sink.Type)
+	}
+
+	// json 時將事件攤平成頂層欄位
+	if sink.Format == "json" {
+		return &eventCore{Core: core}, nil
+	}
+	return core, nil
+}
+
+// json 時使用 CustomLogJSON，其他值使用各輸出原本的 console 編碼器
+func sinkEncoder(format string, console zapcore.Encoder) zapcore.Encoder {
+	if format == "json" {
+		return CustomLogJSON()
+	}
+	return console
+}
+
+func sinkTag(sink models.LogSinkModel) string {
+	if sink.Tag != "" {
+		return sink.Tag
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// levelRange 限制輸出的等級範圍，例如 info.json 只寫 info 和 warn
+type levelRange struct {
+	min zapcore.LevelEnabler
+	max zapcore.Level
+}
+
+func (r levelRange) Enabled(level zapcore.Level) bool {
+	return r.min.Enabled(level) && level <= r.max
+}
+
+// *** 日誌切割 ***//
+// lumberjack：如果 MaxBackups 和 MaxAge均為 0，則不會刪除任何舊的日誌檔。
+// 輸出未設定的欄位沿用 log 區塊的值
+func rotateWriteSyncer(sink models.LogSinkModel, stop <-chan struct{}) zapcore.WriteSyncer {
+	cfg := global.Config().Log
+	maxSize, maxAge, maxBackups, rotate := sink.MaxSize, sink.MaxAge, sink.MaxBackups, sink.Rotate
+	if maxSize == 0 {
+		maxSize = cfg.MaxSize
+	}
+	if maxAge == 0 {
+		maxAge = cfg.MaxAge
+	}
+	if maxBackups == 0 {
+		maxBackups = cfg.MaxBackups
+	}
+	if rotate == "" {
+		rotate = cfg.Rotate
+	}
+	compress, localTime := cfg.Compress, cfg.LocalTime
+	if sink.Compress != nil {
+		compress = *sink.Compress
+	}
+	if sink.LocalTime != nil {
+		localTime = *sink.LocalTime
+	}
+
+	logger := &lumberjack.Logger{
+		Filename:   sink.Path,  // 日誌文件存放目錄，如果文件夾不存在會自動創建
+		MaxSize:    maxSize,    // 文件大小限制,單位MB
+		MaxAge:     maxAge,     // 日誌文件保留天數
+		MaxBackups: maxBackups, // 保留的舊日誌文件數量
+		Compress:   compress,   // 是否壓縮處理
+		LocalTime:  localTime,  // 備份檔名使用本地時間，否則為 UTC
+	}
+	if rotate == "daily" {
+		go rotateDaily(logger, localTime, stop)
+	}
+	return zapcore.AddSync(logger)
+}
+
+// 每天 00:00 切割一次，仍然會依 maxsize 切割，stop 關閉時結束
+func rotateDaily(logger *lumberjack.Logger, local bool, stop <-chan struct{}) {
+	for {
+		now := time.Now()
+		if !local {
+			now = now.UTC()
+		}
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		timer := time.NewTimer(midnight.Sub(now))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := logger.Rotate(); err != nil {
+			log.Printf("Failed to rotate %s: %v", logger.Filename, err)
+		}
+	}
+}
+
+// priorityCore 輸出到 journald 或 syslog，日誌等級對應到各自的 priority，時間和等級由接收端記錄
+type priorityCore struct {
+	zapcore.LevelEnabler
+	enc   zapcore.Encoder
+	write func(zapcore.Level, []byte) error
+}
+
+func (c *priorityCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for _, field := range fields {
+		field.AddTo(clone.enc)
+	}
+	return &clone
+}
+
+func (c *priorityCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *priorityCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+	return c.write(entry.Level, bytes.TrimRight(buf.Bytes(), "\n"))
+}
+
+func (c *priorityCore) Sync() error {
+	return nil
+}
+
+// syslog priority：debug=7、info=6、warn=4、error=3、dpanic 以上=2
+func syslogPriority(level zapcore.Level) int {
+	switch {
+	case level <= zapcore.DebugLevel:
+		return 7
+	case level == zapcore.InfoLevel:
+		return 6
+	case level == zapcore.WarnLevel:
+		return 4
+	case level == zapcore.ErrorLevel:
+		return 3
+	default:
+		return 2
+	}
+}
+
+func syslogWriter(w *syslog.Writer) func(zapcore.Level, []byte) error {
+	return func(level zapcore.Level, msg []byte) error {
+		switch syslogPriority(level) {
+		case 7:
+			return w.Debug(string(msg))
+		case 6:
+			return w.Info(string(msg))
+		case 4:
+			return w.Warning(string(msg))
+		case 3:
+			return w.Err(string(msg))
+		default:
+			return w.Crit(string(msg))
+		}
+	}
+}
+
+// journald native protocol：每行一個 KEY=value，值含換行時改用 KEY\n<64 位元小端長度><值>\n
+func journaldWriter(conn net.Conn, identifier string) func(zapcore.Level, []byte) error {
+	var mu sync.Mutex
+	return func(level zapcore.Level, msg []byte) error {
+		var buf bytes.Buffer
+		journaldField(&buf, "MESSAGE", msg)
+		journaldField(&buf, "PRIORITY", []byte(fmt.Sprint(syslogPriority(level))))
+		journaldField(&buf, "SYSLOG_IDENTIFIER", []byte(identifier))
+
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := conn.Write(buf.Bytes())
+		return err
+	}
+}
+
+func journaldField(buf *bytes.Buffer, key string, value []byte) {
+	if !strings.ContainsRune(string(value), '\n') {
+		fmt.Fprintf(buf, "%s=%s\n", key, value)
+		return
+	}
+	buf.WriteString(key)
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.Write(value)
+	buf.WriteByte('\n')
+}
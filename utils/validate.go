@@ -0,0 +1,398 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"go-redis2influx/alerts"
+	"go-redis2influx/models"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+)
+
+// configErrors 收集所有驗證錯誤，最後一次回報
+type configErrors []error
+
+func (e *configErrors) add(format string, args ...interface{}) {
+	*e = append(*e, fmt.Errorf(format, args...))
+}
+
+func (e *configErrors) nonNegative(key string, value int64) {
+	if value < 0 {
+		e.add("%s must not be negative, got %d", key, value)
+	}
+}
+
+func (e *configErrors) positive(key string, value int64) {
+	if value <= 0 {
+		e.add("%s must be greater than 0, got %d", key, value)
+	}
+}
+
+func (e *configErrors) required(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		e.add("%s is required", key)
+	}
+}
+
+func (e *configErrors) httpURL(key, value string) {
+	if value == "" {
+		e.add("%s is required", key)
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		e.add("%s %q must be an http:// or https:// URL", key, value)
+	}
+}
+
+func (e *configErrors) hostPort(key, value string) {
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		e.add("%s %q must be host:port: %v", key, value, err)
+	}
+}
+
+// * 檢查設定的所有欄位，回傳所有錯誤 (errors.Join)，沒有錯誤時回傳 nil
+func ValidateConfig(config *models.EnvironmentModel) error {
+	var errs configErrors
+
+	// redis
+	redis := config.Redis
+	if redis.Address == "" {
+		errs.add("redis.address is required")
+	} else {
+		errs.hostPort("redis.address", redis.Address)
+	}
+	errs.nonNegative("redis.db", int64(redis.DB))
+	errs.required("redis.group_name", redis.GroupName)
+	errs.required("redis.consumer_name", redis.ConsumerName)
+	errs.required("redis.stream_key", redis.StreamKey)
+	errs.required("redis.message_field", redis.MessageField)
+	if redis.Count <= 0 {
+		errs.add("redis.count must be greater than 0, got %d", redis.Count)
+	}
+	errs.nonNegative("redis.block_ms", int64(redis.BlockMs))
+	errs.nonNegative("redis.retry_delay", int64(redis.RetryDelay))
+	if redis.DeadLetterStream != "" && redis.DeadLetterStream == redis.StreamKey {
+		errs.add("redis.dead_letter_stream must differ from redis.stream_key")
+	}
+
+	// log
+	switch config.Log.Level {
+	case "debug", "info", "error":
+	default:
+		errs.add("log.level %q must be one of error, info, debug", config.Log.Level)
+	}
+	for _, format := range [][2]string{{"log.format.console", config.Log.Format.Console}, {"log.format.file", config.Log.Format.File}} {
+		if format[1] != "" && format[1] != "console" && format[1] != "json" {
+			errs.add("%s %q must be console or json", format[0], format[1])
+		}
+	}
+	errs.nonNegative("log.maxsize", int64(config.Log.MaxSize))
+	errs.nonNegative("log.maxage", int64(config.Log.MaxAge))
+	errs.nonNegative("log.maxbackups", int64(config.Log.MaxBackups))
+	errs.nonNegative("log.min_free_mb", int64(config.Log.MinFreeMB))
+	if config.Log.Rotate != "" && config.Log.Rotate != "size" && config.Log.Rotate != "daily" {
+		errs.add("log.rotate %q must be size or daily", config.Log.Rotate)
+	}
+	errs.nonNegative("log.dedup_interval", int64(config.Log.DedupInterval))
+	errs.nonNegative("log.level_timeout", int64(config.Log.LevelTimeout))
+	sinks := make(map[string]bool)
+	for i, sink := range config.Log.Sinks {
+		key := fmt.Sprintf("log.sinks[%d]", i)
+		if sinks[sink.Name] {
+			errs.add("%s.name %q is used by more than one sink", key, sink.Name)
+		}
+		sinks[sink.Name] = true
+
+		switch sink.Type {
+		case "stdout", "journald":
+		case "file":
+			errs.required(key+".path", sink.Path)
+		case "syslog":
+			switch sink.Network {
+			case "":
+				if sink.Address != "" {
+					errs.add("%s.network is required when address is set", key)
+				}
+			case "tcp", "udp", "unix", "unixgram":
+				errs.required(key+".address", sink.Address)
+			default:
+				errs.add("%s.network %q must be one of tcp, udp, unix, unixgram", key, sink.Network)
+			}
+		default:
+			errs.add("%s.type %q must be one of stdout, file, journald, syslog", key, sink.Type)
+		}
+
+		minLevel, maxLevel := zapcore.DebugLevel, zapcore.FatalLevel
+		for _, level := range []struct {
+			name, value string
+			parsed      *zapcore.Level
+		}{{"level", sink.Level, &minLevel}, {"max_level", sink.MaxLevel, &maxLevel}} {
+			switch level.value {
+			case "":
+			case "debug", "info", "warn", "error":
+				*level.parsed, _ = zapcore.ParseLevel(level.value)
+			default:
+				errs.add("%s.%s %q must be one of debug, info, warn, error", key, level.name, level.value)
+			}
+		}
+		if minLevel > maxLevel {
+			errs.add("%s.level %q must not exceed max_level %q", key, sink.Level, sink.MaxLevel)
+		}
+		if sink.Format != "" && sink.Format != "console" && sink.Format != "json" {
+			errs.add("%s.format %q must be console or json", key, sink.Format)
+		}
+		errs.nonNegative(key+".maxsize", int64(sink.MaxSize))
+		errs.nonNegative(key+".maxage", int64(sink.MaxAge))
+		errs.nonNegative(key+".maxbackups", int64(sink.MaxBackups))
+		if sink.Rotate != "" && sink.Rotate != "size" && sink.Rotate != "daily" {
+			errs.add("%s.rotate %q must be size or daily", key, sink.Rotate)
+		}
+	}
+
+	// outputs，未設定時使用 influxdb 區塊作為唯一的必要輸出端
+	outputs := config.Outputs
+	if len(outputs) == 0 {
+		outputs = []models.OutputModel{{Name: "influxdb", Type: "influxdb", Required: true}}
+	}
+	usesInfluxdb := config.Telemetry.Interval > 0 || config.Events.Bucket != ""
+	usesInfluxOptions := usesInfluxdb
+	hasRequired := false
+	names := make(map[string]bool)
+	for i, output := range outputs {
+		key := fmt.Sprintf("outputs[%d]", i)
+		if output.Type == "" {
+			output.Type = "influxdb"
+		}
+		if output.Name == "" {
+			output.Name = output.Type
+		}
+		if names[output.Name] {
+			errs.add("%s.name %q is used by more than one output", key, output.Name)
+		}
+		names[output.Name] = true
+		hasRequired = hasRequired || output.Required
+
+		switch output.Type {
+		case "influxdb":
+			usesInfluxOptions = true
+			if output.URL == "" || output.Token == "" || output.Org == "" || output.Bucket == "" {
+				usesInfluxdb = true
+			}
+			if output.URL != "" {
+				errs.httpURL(key+".url", output.URL)
+			}
+		case "prometheus":
+			errs.httpURL(key+".url", output.URL)
+		case "file":
+			errs.required(key+".path", output.Path)
+			switch output.Rotate {
+			case "", "hourly", "size":
+			default:
+				errs.add("%s.rotate %q must be hourly or size", key, output.Rotate)
+			}
+		default:
+			errs.add("%s.type %q must be one of influxdb, prometheus, file", key, output.Type)
+		}
+		errs.nonNegative(key+".buffer_size", int64(output.BufferSize))
+		errs.nonNegative(key+".retry_delay", int64(output.RetryDelay))
+		errs.nonNegative(key+".timeout", int64(output.Timeout))
+		errs.nonNegative(key+".maxsize", int64(output.MaxSize))
+	}
+	if !hasRequired {
+		errs.add("outputs must contain at least one required output, otherwise messages are acknowledged without being written")
+	}
+
+	// influxdb 區塊被輸出端沿用或供自我遙測使用時必須完整
+	if usesInfluxdb {
+		errs.httpURL("influxdb.url", config.Influxdb.URL)
+		errs.required("influxdb.token", config.Influxdb.Token)
+		errs.required("influxdb.org", config.Influxdb.Org)
+		errs.required("influxdb.bucket", config.Influxdb.Bucket)
+	}
+
+	// 所有 InfluxDB 客戶端共用 influxdb.options，批次大小或間隔為 0 時客戶端會在建立寫入 API 時除以零
+	if usesInfluxOptions {
+		options := config.Influxdb.Options
+		errs.positive("influxdb.options.set_batch_size", int64(options.SetBatchSize))
+		errs.positive("influxdb.options.set_flush_interval", int64(options.SetFlushInterval))
+		errs.positive("influxdb.options.set_retry_interval", int64(options.SetRetryInterval))
+		errs.positive("influxdb.options.set_max_retry_time", int64(options.SetMaxRetryTime))
+		errs.positive("influxdb.options.set_http_request_timeout", int64(options.SetHTTPRequestTimeout))
+		errs.nonNegative("influxdb.options.set_max_retries", int64(options.SetMaxRetries))
+		if options.SetLogLevel < 0 || options.SetLogLevel > 3 {
+			errs.add("influxdb.options.set_log_level must be between 0 (error) and 3 (debug), got %d", options.SetLogLevel)
+		}
+	}
+
+	// writer
+	errs.nonNegative("writer.max_lines", int64(config.Writer.MaxLines))
+	errs.nonNegative("writer.max_bytes", int64(config.Writer.MaxBytes))
+	errs.nonNegative("writer.parallelism", int64(config.Writer.Parallelism))
+
+	// http / admin / health
+	if config.HTTP.Address != "" {
+		errs.hostPort("http.address", config.HTTP.Address)
+	}
+	if config.Admin.Token != "" && config.HTTP.Address == "" {
+		errs.add("admin.token is set but http.address is empty, the admin API would not be served")
+	}
+	errs.nonNegative("health.max_heartbeat_age", int64(config.Health.MaxHeartbeatAge))
+	errs.nonNegative("health.timeout", int64(config.Health.Timeout))
+
+	// telemetry
+	errs.nonNegative("telemetry.interval", int64(config.Telemetry.Interval))
+	if config.Telemetry.Interval > 0 {
+		errs.required("telemetry.bucket", config.Telemetry.Bucket)
+	}
+
+	// events
+	switch config.Events.Level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		errs.add("events.level %q must be one of debug, info, warn, error", config.Events.Level)
+	}
+	errs.nonNegative("events.buffer_size", int64(config.Events.BufferSize))
+	errs.nonNegative("events.flush_interval", int64(config.Events.FlushInterval))
+
+	// monitor，warn 和 error 都設定時 warn 必須較小
+	monitor := config.Monitor
+	errs.nonNegative("monitor.interval", int64(monitor.Interval))
+	for _, threshold := range []struct {
+		name        string
+		warn, error int64
+	}{
+		{"lag", monitor.LagWarn, monitor.LagError},
+		{"pending", monitor.PendingWarn, monitor.PendingError},
+		{"oldest_pending", monitor.OldestPendingWarn, monitor.OldestPendingError},
+	} {
+		errs.nonNegative("monitor."+threshold.name+"_warn", threshold.warn)
+		errs.nonNegative("monitor."+threshold.name+"_error", threshold.error)
+		if threshold.warn > 0 && threshold.error > 0 && threshold.warn > threshold.error {
+			errs.add("monitor.%s_warn (%d) must not exceed monitor.%s_error (%d)", threshold.name, threshold.warn, threshold.name, threshold.error)
+		}
+	}
+
+	// notify，門檻為 0 時不檢查該條件
+	notify := config.Notify
+	errs.nonNegative("notify.influx_down_minutes", int64(notify.InfluxDownMinutes))
+	errs.nonNegative("notify.pending_growth_checks", int64(notify.PendingGrowthChecks))
+	errs.nonNegative("notify.rejected_per_minute", int64(notify.RejectedPerMinute))
+	if notify.PendingGrowthChecks > 0 && monitor.Interval <= 0 {
+		errs.add("notify.pending_growth_checks is set but monitor.interval is 0, the pending entries list is never checked")
+	}
+	receivers := make(map[string]bool)
+	for i, receiver := range notify.Receivers {
+		key := fmt.Sprintf("notify.receivers[%d]", i)
+		errs.httpURL(key+".url", receiver.URL)
+		name := receiver.Name
+		if name == "" {
+			name = receiver.URL
+		}
+		if receivers[name] {
+			errs.add("%s.name %q is used by more than one receiver", key, name)
+		}
+		receivers[name] = true
+		if _, err := alerts.ParseTemplate(receiver.Template); err != nil {
+			errs.add("%s.template: %v", key, err)
+		}
+		for _, status := range receiver.Statuses {
+			if status != alerts.StatusFiring && status != alerts.StatusResolved {
+				errs.add("%s.statuses %q must be firing or resolved", key, status)
+			}
+		}
+		if receiver.Retries != nil {
+			errs.nonNegative(key+".retries", int64(*receiver.Retries))
+		}
+		errs.nonNegative(key+".retry_delay", int64(receiver.RetryDelay))
+		errs.nonNegative(key+".rate_limit", int64(receiver.RateLimit))
+		errs.nonNegative(key+".timeout", int64(receiver.Timeout))
+	}
+
+	// circuit_breaker
+	errs.nonNegative("circuit_breaker.failure_threshold", int64(config.CircuitBreaker.FailureThreshold))
+	errs.nonNegative("circuit_breaker.max_delay", int64(config.CircuitBreaker.MaxDelay))
+
+	return errors.Join(errs...)
+}
+
+// * 回傳設定檔中 EnvironmentModel 沒有對應欄位的鍵，通常是拼錯的設定名稱
+func UnknownConfigKeys() []string {
+	known := make(map[string]bool)
+	collectConfigKeys(reflect.TypeOf(models.EnvironmentModel{}), "", known)
+
+	var unknown []string
+	for _, key := range viper.AllKeys() {
+		if _, ok := known[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+
+	// outputs、log.sinks 和 notify.receivers 為列表，viper 不會展開，逐項比對欄位
+	unknown = append(unknown, unknownListKeys("outputs", models.OutputModel{})...)
+	unknown = append(unknown, unknownListKeys("log.sinks", models.LogSinkModel{})...)
+	unknown = append(unknown, unknownListKeys("notify.receivers", models.ReceiverModel{})...)
+
+	sort.Strings(unknown)
+	return unknown
+}
+
+// 列表設定中 model 沒有對應欄位的鍵
+func unknownListKeys(key string, model interface{}) []string {
+	known := make(map[string]bool)
+	collectConfigKeys(reflect.TypeOf(model), "", known)
+
+	var unknown []string
+	items, _ := viper.Get(key).([]interface{})
+	for i, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for field := range fields {
+			if _, ok := known[strings.ToLower(field)]; !ok {
+				unknown = append(unknown, fmt.Sprintf("%s[%d].%s", key, i, field))
+			}
+		}
+	}
+	return unknown
+}
+
+// 依 mapstructure 標籤 (未設定時為小寫欄位名稱，與 viper 相同) 列出所有設定鍵，值為 true 表示是最底層的欄位
+func collectConfigKeys(t reflect.Type, prefix string, keys map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		key := prefix + name
+		keys[key] = field.Type.Kind() != reflect.Struct
+		if field.Type.Kind() == reflect.Struct {
+			collectConfigKeys(field.Type, key+".", keys)
+		}
+	}
+}
+
+// * 檢查設定檔和事件目錄但不啟動服務，回傳未知的鍵和所有驗證錯誤
+func CheckConfigFile(path string) ([]string, error) {
+	if err := readConfigFile(path); err != nil {
+		return nil, err
+	}
+	config, err := decodeEnvConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	errs := []error{ValidateConfig(config)}
+	if _, file, err := readEventLogConfig(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", file, err))
+	}
+	return UnknownConfigKeys(), errors.Join(errs...)
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// 以 config.example.yml 為基礎寫出修改後的設定檔，回傳路徑
+func writeConfig(t *testing.T, edit func(string) string) string {
+	t.Helper()
+	example, err := os.ReadFile("../config.example.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(edit(string(example))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckConfigFileExample(t *testing.T) {
+	path := writeConfig(t, func(s string) string { return s })
+	if _, err := CheckConfigFile(path); err != nil {
+		t.Fatalf("config.example.yml should be valid: %v", err)
+	}
+}
+
+func TestCheckConfigFileInfluxOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(string) string
+		want []string
+	}{
+		{
+			name: "options block missing",
+			edit: func(s string) string {
+				return regexp.MustCompile(`(?s)\n  options:[^\n]*\n.*?set_application_name: "[^"]*"\n`).ReplaceAllString(s, "\n")
+			},
+			want: []string{
+				"influxdb.options.set_batch_size must be greater than 0",
+				"influxdb.options.set_flush_interval must be greater than 0",
+				"influxdb.options.set_retry_interval must be greater than 0",
+				"influxdb.options.set_max_retry_time must be greater than 0",
+				"influxdb.options.set_http_request_timeout must be greater than 0",
+			},
+		},
+		{
+			name: "zero batch size",
+			edit: func(s string) string {
+				return strings.Replace(s, "set_batch_size: 5000", "set_batch_size: 0", 1)
+			},
+			want: []string{"influxdb.options.set_batch_size must be greater than 0, got 0"},
+		},
+		{
+			name: "negative max retries",
+			edit: func(s string) string {
+				return strings.Replace(s, "set_max_retries: 5", "set_max_retries: -1", 1)
+			},
+			want: []string{"influxdb.options.set_max_retries must not be negative"},
+		},
+		{
+			name: "log level out of range",
+			edit: func(s string) string {
+				return strings.Replace(s, "set_log_level: 1", "set_log_level: 4", 1)
+			},
+			want: []string{"influxdb.options.set_log_level must be between 0 (error) and 3 (debug), got 4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CheckConfigFile(writeConfig(t, tt.edit))
+			if err == nil {
+				t.Fatal("expected the config to be rejected")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckConfigFileInfluxOptionsUnused(t *testing.T) {
+	// 只有檔案輸出且未啟用自我遙測和事件時不會建立 InfluxDB 客戶端，不需要 options
+	path := writeConfig(t, func(s string) string {
+		s = regexp.MustCompile(`(?s)\n  options:[^\n]*\n.*?set_application_name: "[^"]*"\n`).ReplaceAllString(s, "\n")
+		s = strings.Replace(s, "telemetry:\n  interval: 30", "telemetry:\n  interval: 0", 1)
+		s = strings.Replace(s, `bucket: "redis2influx_events"`, `bucket: ""`, 1)
+		return s + "\noutputs:\n  - name: archive\n    type: file\n    path: " + t.TempDir() + "\n    required: true\n"
+	})
+	_, err := CheckConfigFile(path)
+	if err != nil && strings.Contains(err.Error(), "influxdb.options") {
+		t.Errorf("influxdb.options should not be checked without an InfluxDB client: %v", err)
+	}
+}